@@ -1,7 +1,10 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"gocos/cosclient"
+	"gocos/filter"
 	"gopkg.in/alecthomas/kingpin.v2"
 	"encoding/json"
 	"text/template"
@@ -10,26 +13,154 @@ import (
 	"strings"
 	"sync"
 	"io"
-	"bytes"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
 )
 
-var Failure = false
+// ReportRetry reports a request about to be retried, it is meant for CosClient.OnRetry. The
+// text output prints it to stderr, json and ndjson report it as a "retry" event. Retries are
+// not tallied for the exit code, the request may still succeed.
+func ReportRetry(what string, attempt int, err error) {
+	e := newEvent("retry", what, err)
+	e.Status = STATUS_RETRY
+	e.Attempt = attempt
+	e.Text = fmt.Sprintf("[retry %d  %s] - %s\r\n", attempt, what, err)
+	if view != nil {
+		view.print(func() { reporter.Report(e) })
+	} else {
+		reporter.Report(e)
+	}
+}
 
 type Command interface {
-	Execute(cosClient *cosclient.CosClient)
+	Execute(ctx context.Context, cosClient *cosclient.CosClient)
 	Name() string
 }
 
 type ListCommand struct {
-	clause *kingpin.CmdClause
-	remote *string
+	clause    *kingpin.CmdClause
+	remote    *string
+	filter    *filterFlags
+	long      *bool
+	recursive *bool
+	human     *bool
+	sortBy    *string
+	reverse   *bool
 }
 
 func (l *ListCommand) Name() string {
 	return l.clause.FullCommand()
 }
-func (l *ListCommand) Execute(cosClient *cosclient.CosClient) {
-	cosClient.List(*l.remote, "")
+func (l *ListCommand) Execute(ctx context.Context, cosClient *cosclient.CosClient) {
+	f := l.filter.build()
+	dir := *l.remote
+
+	var resources []cosclient.CosResource
+	var err error
+	if *l.recursive && strings.HasSuffix(dir, "/") {
+		err = cosClient.WalkContext(ctx, dir, func(path string, resource cosclient.CosResource) error {
+			resource.Name = path[len(dir):]
+			if !f.Match(resource.Name) {
+				return cosclient.SkipDir
+			}
+			resources = append(resources, resource)
+			return nil
+		})
+	} else {
+		var all []cosclient.CosResource
+		all, err = cosClient.ListContext(ctx, dir)
+		for _, resource := range all {
+			if f.Match(resource.Name) {
+				resources = append(resources, resource)
+			}
+		}
+	}
+
+	l.sort(resources)
+	for i := range resources {
+		resource := &resources[i]
+		e := newEvent("ls", dir+resource.Name, nil)
+		e.Bytes = resource.FileSize
+		e.Info = resource
+		e.Text = resource.Name + "\n"
+		if *l.long {
+			e.Text = l.format(resource) + "\n"
+		}
+		report(e)
+	}
+	exitFailed("ls", dir, err)
+}
+
+func (l *ListCommand) sort(resources []cosclient.CosResource) {
+	less := func(i, j int) bool { return resources[i].Name < resources[j].Name }
+	switch *l.sortBy {
+	case "size":
+		less = func(i, j int) bool { return resources[i].FileSize < resources[j].FileSize }
+	case "time":
+		less = func(i, j int) bool { return resources[i].Mtime < resources[j].Mtime }
+	}
+	if *l.reverse {
+		forward := less
+		less = func(i, j int) bool { return forward(j, i) }
+	}
+	sort.SliceStable(resources, less)
+}
+
+// format renders a resource for ls -l: authority, size, mtime, sha and name.
+func (l *ListCommand) format(resource *cosclient.CosResource) string {
+	size, sha, authority := "-", "-", "-"
+	if !resource.IsDir() {
+		size = strconv.FormatInt(resource.FileSize, 10)
+		if *l.human {
+			size = humanSize(resource.FileSize)
+		}
+		if resource.Sha != "" {
+			sha = resource.Sha
+		}
+	}
+	if resource.Authority != "" {
+		authority = resource.Authority
+	}
+	mtime := time.Unix(resource.Mtime, 0).Format("2006-01-02 15:04")
+	return fmt.Sprintf("%-16s %10s %s %-40s %s", authority, size, mtime, sha, resource.Name)
+}
+
+// humanSize formats a byte count with a binary unit suffix, like 1.5K or 23M.
+func humanSize(size int64) string {
+	if size < 1024 {
+		return strconv.FormatInt(size, 10)
+	}
+	value := float64(size)
+	unit := 0
+	for value >= 1024 && unit < 5 {
+		value /= 1024
+		unit++
+	}
+	format := "%.0f%c"
+	if value < 10 {
+		format = "%.1f%c"
+	}
+	return fmt.Sprintf(format, value, "BKMGTP"[unit])
+}
+
+// ParseSize parses a byte count with an optional binary unit suffix, like 512K, 4M or 4MB.
+func ParseSize(value string) (int64, error) {
+	s := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(value)), "B")
+	shift := uint(0)
+	if s != "" {
+		if i := strings.IndexByte("KMGTP", s[len(s)-1]); i >= 0 {
+			shift = uint(i+1) * 10
+			s = s[:len(s)-1]
+		}
+	}
+	size, err := strconv.ParseFloat(s, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid size %q, expected bytes like 1048576 or 512K, 4M", value)
+	}
+	return int64(size * float64(int64(1)<<shift)), nil
 }
 
 func CreateListCommand(app *kingpin.Application) *ListCommand {
@@ -37,6 +168,12 @@ func CreateListCommand(app *kingpin.Application) *ListCommand {
 	return &ListCommand{
 		clause:clause,
 		remote:  clause.Arg("path", "path on cos").Required().String(),
+		filter: addFilterFlags(clause),
+		long: clause.Flag("long", "show authority, size, mtime and sha").Short('l').Bool(),
+		recursive: clause.Flag("recursive", "list subdirectories recursively").Short('R').Bool(),
+		human: clause.Flag("human-readable", "print sizes like 1.5K, 23M").Short('h').Bool(),
+		sortBy: clause.Flag("sort", "sort by name, size or time").Default("name").Enum("name", "size", "time"),
+		reverse: clause.Flag("reverse", "reverse the sort order").Short('r').Bool(),
 	}
 }
 
@@ -46,18 +183,38 @@ type StatCommand struct {
 	format *string
 }
 
-func (s *StatCommand) Execute(cosClient *cosclient.CosClient) {
-	stat := cosClient.StatFile(*s.remote)
+func (s *StatCommand) Execute(ctx context.Context, cosClient *cosclient.CosClient) {
+	stat, err := cosClient.StatFileContext(ctx, *s.remote)
+	exitFailed("stat", *s.remote, err)
+	e := newEvent("stat", *s.remote, nil)
+	e.Bytes = stat.FileSize
+	e.Info = stat
 	if *s.format == "" {
 		r, _ := json.MarshalIndent(stat, "", "  ")
-		fmt.Println(string(r))
+		e.Text = string(r) + "\n"
 	} else {
 		t, err := template.New("StatFormat").Parse(*s.format);
-		if err != nil {
-			panic(err)
-		}
-		t.Execute(os.Stdout, stat)
+		exitIfErr(err)
+		var text strings.Builder
+		exitIfErr(t.Execute(&text, statFormatData(stat)))
+		e.Text = text.String()
+	}
+	report(e)
+}
+
+// statFormatData is what the --format template of stat runs on: the fields of stat, and
+// code, message and data shaped like the raw response earlier versions used, so templates
+// like {{.data.sha}} keep working.
+func statFormatData(stat *cosclient.StatFileResult) map[string]interface{} {
+	data := map[string]interface{}{}
+	raw, _ := json.Marshal(stat)
+	json.Unmarshal(raw, &data)
+	fields := map[string]interface{}{"code": 0, "message": "SUCCESS", "data": data}
+	v := reflect.ValueOf(*stat)
+	for i := 0; i < v.NumField(); i++ {
+		fields[v.Type().Field(i).Name] = v.Field(i).Interface()
 	}
+	return fields
 }
 
 func (s *StatCommand) Name() string {
@@ -74,16 +231,20 @@ func CreateStatCommand(app *kingpin.Application) *StatCommand {
 }
 
 type PullCommand struct {
-	clause *kingpin.CmdClause
-	remote *string
-	local  *string
+	clause          *kingpin.CmdClause
+	remote          *string
+	local           *string
+	concurrency     *int
+	partSize        *string
+	partConcurrency *int
+	filter          *filterFlags
 }
 
 func (l *PullCommand) Name() string {
 	return l.clause.FullCommand()
 }
 
-func (p *PullCommand) Execute(cosClient *cosclient.CosClient) {
+func (p *PullCommand) Execute(ctx context.Context, cosClient *cosclient.CosClient) {
 	local := *p.local
 	if local == "" {
 		local, _ = os.Getwd()
@@ -95,32 +256,43 @@ func (p *PullCommand) Execute(cosClient *cosclient.CosClient) {
 	if strings.HasSuffix(*p.remote, "/") && !strings.HasSuffix(local, string(os.PathSeparator)) {
 		local += string(os.PathSeparator)
 	}
+	applyConcurrency(&cosClient.FileConcurrency, "--concurrency", *p.concurrency)
+	applySize(&cosClient.DownloadPartSize, "--part-size", *p.partSize)
+	applyConcurrency(&cosClient.DownloadConcurrency, "--part-concurrency", *p.partConcurrency)
 
-	threadPoll := make(chan int, 20)
-	for i := 0; i < 20; i++ {
+	concurrency := cosClient.EffectiveFileConcurrency()
+	threadPoll := make(chan int, concurrency)
+	for i := 0; i < concurrency; i++ {
 		threadPoll <- 1
 	}
 	waitter := &sync.WaitGroup{}
-	pull(cosClient, *p.remote, local, threadPoll, waitter)
+	pull(ctx, cosClient, p.filter.build(), *p.remote, *p.remote, local, threadPoll, waitter)
 	waitter.Wait()
 }
 
-func pull(cosClient *cosclient.CosClient, remote, local string, threads chan int, waitter  *sync.WaitGroup) {
+// pull downloads remote to local; f selects the files below root, the remote directory pulled.
+func pull(ctx context.Context, cosClient *cosclient.CosClient, f *filter.Filter, root, remote, local string, threads chan int, waitter  *sync.WaitGroup) {
+	if ctx.Err() != nil {
+		return
+	}
 
 	if strings.HasSuffix(remote, "/") {
 		os.MkdirAll(local, 0766)
 
-		goon := true
-		context := ""
-		for ; goon; {
-			resp := cosClient.ExecList(remote, context)
-			context = resp.Data.Context
-			goon = context != ""
-			for _, v := range resp.Data.Infos {
-				tremote := remote + v.Name
-				tlocal := local + strings.Replace(v.Name, "/", string(os.PathSeparator), -1)
-				pull(cosClient, tremote, tlocal, threads, waitter)
+		resources, err := cosClient.ListContext(ctx, remote)
+		if err != nil {
+			e := newEvent("ls", remote, err)
+			e.Text = fmt.Sprintf("list %s failure: %s\r\n", remote, err)
+			report(e)
+			return
+		}
+		for _, v := range resources {
+			tremote := remote + v.Name
+			if !f.Match(tremote[len(root):]) {
+				continue
 			}
+			tlocal := local + strings.Replace(v.Name, "/", string(os.PathSeparator), -1)
+			pull(ctx, cosClient, f, root, tremote, tlocal, threads, waitter)
 		}
 
 	} else {
@@ -128,14 +300,28 @@ func pull(cosClient *cosclient.CosClient, remote, local string, threads chan int
 			fname := remote[strings.LastIndex(remote, "/"):]
 			local += fname
 		}
+		select {
+		case <-threads:
+		case <-ctx.Done():
+			return
+		}
 		waitter.Add(1)
-		<-threads
 		go func(cosClient *cosclient.CosClient, remote, local string) {
 			defer func() {
 				threads <- 1
 				waitter.Done()
 			}()
-			cosClient.Download(remote, local, 0, nil)
+			start := time.Now()
+			n, err := cosClient.DownloadContext(ctx, remote, local)
+			e := newEvent("pull", remote, err).since(start)
+			e.Target = local
+			e.Bytes = n
+			if err != nil {
+				e.Text = fmt.Sprintf("download %s failure: %s\r\n", remote, err)
+			} else {
+				e.Text = fmt.Sprintf("download %s to %s success!\r\n", remote, local)
+			}
+			report(e)
 		}(cosClient, remote, local)
 
 	}
@@ -147,32 +333,109 @@ func CreatePullCommand(app *kingpin.Application) *PullCommand {
 		clause:clause,
 		remote:  clause.Arg("remote", "remote path").Required().String(),
 		local: clause.Arg("local", "local path").String(),
+		concurrency: clause.Flag("concurrency", "files downloaded concurrently").Short('j').Int(),
+		partSize: clause.Flag("part-size", "byte range size for fetching large files in parts, e.g. 8M").String(),
+		partConcurrency: clause.Flag("part-concurrency", "parts fetched concurrently per file, 1 disables ranged download").Int(),
+		filter: addFilterFlags(clause),
 	}
 }
 
 type PushCommand struct {
-	clause *kingpin.CmdClause
-	local  *string
-	remote *string
-	cover  *bool
+	clause          *kingpin.CmdClause
+	local           *string
+	remote          *string
+	cover           *bool
+	concurrency     *int
+	partSize        *string
+	partConcurrency *int
+	filter          *filterFlags
 }
 
 func (l *PushCommand) Name() string {
 	return l.clause.FullCommand()
 }
 
-func (p *PushCommand) Execute(cosClient *cosclient.CosClient) {
-	cosClient.Upload(*p.local, *p.remote, *p.cover)
+// fromStdin reports whether <local> is "-"; kingpin hands over a lone "-" as an empty argument.
+func (p *PushCommand) fromStdin() bool {
+	return *p.local == "-" || *p.local == ""
+}
+
+func (p *PushCommand) Execute(ctx context.Context, cosClient *cosclient.CosClient) {
+	applyConcurrency(&cosClient.FileConcurrency, "--concurrency", *p.concurrency)
+	applySize(&cosClient.UploadPartSize, "--part-size", *p.partSize)
+	applyConcurrency(&cosClient.UploadConcurrency, "--part-concurrency", *p.partConcurrency)
+	if err := cosClient.CheckUploadSettings(); err != nil {
+		exitUsage(err)
+	}
+
+	done := func(result *cosclient.UploadResult) {
+		e := newEvent("push", result.Local, result.Err)
+		e.Target = result.Remote
+		e.Bytes = result.Size
+		e.Duration = result.Duration.Seconds()
+		if result.Err == nil {
+			e.Text = fmt.Sprintf("[ok   %s]\r\n", result.Remote)
+		} else {
+			e.Text = fmt.Sprintf("[failre  %s] - %s\r\n", result.Remote, result.Err)
+		}
+		report(e)
+	}
+
+	if p.fromStdin() {
+		if strings.HasSuffix(*p.remote, "/") {
+			exitUsage(errors.New("<remote> must be a file when pushing from stdin"))
+		}
+		start := time.Now()
+		size, err := cosClient.UploadReader(ctx, os.Stdin, *p.remote, cosclient.UploadOptions{Cover: *p.cover})
+		done(&cosclient.UploadResult{Local: *p.local, Remote: *p.remote, Size: size, Duration: time.Since(start), Err: err})
+		return
+	}
+
+	_, err := os.Stat(*p.local)
+	exitFailed("push", *p.local, err)
+	err = cosClient.UploadContext(ctx, *p.local, *p.remote, *p.cover, p.filter.pathFilter(), done)
+	if err == cosclient.ErrRemoteNotDir {
+		exitUsage(err)
+	}
+	if err != nil && !hasFailures() {
+		exitFailed("push", *p.local, err)
+	}
 }
 
 func CreatePushCommand(app *kingpin.Application) *PushCommand {
 	clause := app.Command("push", "pusl local file to cos")
 	return &PushCommand{
 		clause:clause,
-		local: clause.Arg("local", "local path").Required().ExistingFileOrDir(),
+		local: clause.Arg("local", "local path, - reads from stdin").Required().String(),
 		remote:  clause.Arg("remote", "remote path").Required().String(),
 		cover: clause.Flag("force", "force cover files on cos").Short('f').Bool(),
+		concurrency: clause.Flag("concurrency", "files uploaded concurrently").Short('j').Int(),
+		partSize: clause.Flag("part-size", "slice size for uploading large files, e.g. 1M").String(),
+		partConcurrency: clause.Flag("part-concurrency", "slices uploaded concurrently per file").Int(),
+		filter: addFilterFlags(clause),
+	}
+}
+
+// applyConcurrency sets *setting to the value of flag when it was given.
+func applyConcurrency(setting *int, flag string, value int) {
+	if value < 0 {
+		exitUsage(fmt.Errorf("%s must be positive", flag))
+	}
+	if value > 0 {
+		*setting = value
+	}
+}
+
+// applySize sets *setting to the size of flag when it was given.
+func applySize(setting *int64, flag string, value string) {
+	if value == "" {
+		return
 	}
+	size, err := ParseSize(value)
+	if err != nil {
+		exitUsage(fmt.Errorf("%s: %w", flag, err))
+	}
+	*setting = size
 }
 
 type RmCommand struct {
@@ -180,14 +443,29 @@ type RmCommand struct {
 	remote    *string
 	recursive *bool
 	force     *bool
+	filter    *filterFlags
 }
 
 func (l *RmCommand) Name() string {
 	return l.clause.FullCommand()
 }
 
-func (r *RmCommand) Execute(cosClient *cosclient.CosClient) {
-	cosClient.DeleteResource(*r.remote, *r.recursive, *r.force)
+func (r *RmCommand) Execute(ctx context.Context, cosClient *cosclient.CosClient) {
+	err := cosClient.DeleteResourceContext(ctx, *r.remote, *r.recursive, *r.force, r.filter.pathFilter(), func(path string, err error) {
+		e := newEvent("rm", path, err)
+		if err == nil {
+			e.Text = fmt.Sprintf("[Deleted %s]\r\n", path)
+		} else {
+			e.Text = fmt.Sprintf("Failure(%s), %s\r\n", err, path)
+		}
+		report(e)
+	})
+	if err == cosclient.ErrIsDirectory {
+		exitUsage(errors.New("use -r for delete directories"))
+	}
+	if err != nil && !hasFailures() {
+		exitFailed("rm", *r.remote, err)
+	}
 }
 
 func CreateRmCommand(app *kingpin.Application) *RmCommand {
@@ -198,6 +476,7 @@ func CreateRmCommand(app *kingpin.Application) *RmCommand {
 		remote:   clause.Arg("remote", "remote cos path").Required().String(),
 		recursive : clause.Flag("recursive", "remove directories and their contents recursively").Short('r').Bool(),
 		force:clause.Flag("force", "force rm even has children").Short('f').Bool(),
+		filter: addFilterFlags(clause),
 	}
 }
 
@@ -212,8 +491,20 @@ func (l *MvCommand) Name() string {
 	return l.clause.FullCommand()
 }
 
-func (r *MvCommand) Execute(cosClient *cosclient.CosClient) {
-	cosClient.Move(*r.src, *r.target, *r.force)
+func (r *MvCommand) Execute(ctx context.Context, cosClient *cosclient.CosClient) {
+	start := time.Now()
+	err := cosClient.MoveContext(ctx, *r.src, *r.target, *r.force)
+	if err == cosclient.ErrIsDirectory {
+		exitUsage(errors.New("can not move directory !"))
+	}
+	e := newEvent("mv", *r.src, err).since(start)
+	e.Target = *r.target
+	if err == nil {
+		e.Text = fmt.Sprintf("[Move %s to %s Success]\r\n", *r.src, *r.target)
+	} else {
+		e.Text = fmt.Sprintf("[Move %s to %s failure : %s]\r\n", *r.src, *r.target, err)
+	}
+	report(e)
 }
 
 func CreateMvCommand(app *kingpin.Application) *MvCommand {
@@ -228,21 +519,57 @@ func CreateMvCommand(app *kingpin.Application) *MvCommand {
 }
 
 type CatCommand struct {
-	clause *kingpin.CmdClause
-	remote *string
+	clause    *kingpin.CmdClause
+	remotes   *[]string
+	byteRange *string
+	head      *int64
+	tail      *int64
 }
 
 func (l *CatCommand) Name() string {
 	return l.clause.FullCommand()
 }
 
-func (r *CatCommand) Execute(cosClient *cosclient.CosClient) {
-	callback := func(reader  io.Reader) {
-		buf := new(bytes.Buffer)
-		buf.ReadFrom(reader)
-		fmt.Println(buf.String())
+func (r *CatCommand) Execute(ctx context.Context, cosClient *cosclient.CosClient) {
+	byteRange, err := r.rangeSpec()
+	if err != nil {
+		exitUsage(err)
+	}
+
+	callback := func(reader  io.Reader) error {
+		_, err := io.Copy(os.Stdout, reader)
+		return err
+	}
+	for _, remote := range *r.remotes {
+		exitFailed("cat", remote, cosClient.DownloadRangeContext(ctx, remote, byteRange, callback))
 	}
-	cosClient.DownloadStream(*r.remote, callback);
+}
+
+var rangePattern = regexp.MustCompile(`^(\d+-\d*|-\d+)$`)
+
+// rangeSpec turns --range, --head and --tail into an HTTP byte range.
+func (r *CatCommand) rangeSpec() (string, error) {
+	set := 0
+	spec := ""
+	if *r.byteRange != "" {
+		set++
+		if !rangePattern.MatchString(*r.byteRange) {
+			return "", fmt.Errorf("invalid range %q, use start-end, start- or -length", *r.byteRange)
+		}
+		spec = *r.byteRange
+	}
+	if *r.head > 0 {
+		set++
+		spec = "0-" + strconv.FormatInt(*r.head-1, 10)
+	}
+	if *r.tail > 0 {
+		set++
+		spec = "-" + strconv.FormatInt(*r.tail, 10)
+	}
+	if set > 1 {
+		return "", errors.New("--range, --head and --tail can not be used together")
+	}
+	return spec, nil
 }
 
 func CreateCatCommand(app *kingpin.Application) *CatCommand {
@@ -250,7 +577,10 @@ func CreateCatCommand(app *kingpin.Application) *CatCommand {
 
 	return &CatCommand{
 		clause:clause,
-		remote:   clause.Arg("remote", "cos file ").Required().String(),
+		remotes:   clause.Arg("remote", "cos files, printed in order").Required().Strings(),
+		byteRange: clause.Flag("range", "only print bytes start-end (inclusive), start- or -length").String(),
+		head: clause.Flag("head", "only print the first N bytes").Int64(),
+		tail: clause.Flag("tail", "only print the last N bytes").Int64(),
 	}
 }
 
@@ -264,13 +594,17 @@ func (l *UpdateCommand) Name() string {
 	return l.clause.FullCommand()
 }
 
-func (r *UpdateCommand) Execute(cosClient *cosclient.CosClient) {
-	response := cosClient.UpdateAuthority(r.remote, r.authority);
-	if response.Code == 0 {
-		fmt.Printf("success")
+func (r *UpdateCommand) Execute(ctx context.Context, cosClient *cosclient.CosClient) {
+	start := time.Now()
+	err := cosClient.UpdateAuthorityContext(ctx, *r.remote, *r.authority);
+	e := newEvent("update", *r.remote, err).since(start)
+	e.Info = map[string]string{"authority": *r.authority}
+	if err == nil {
+		e.Text = "success"
 	}else{
-		fmt.Fprintf(os.Stderr, "error: %d - %s\n",response.Code, response.Message)
+		e.Text = fmt.Sprintf("error: %s\n", err)
 	}
+	report(e)
 }
 
 func CreateUpdateCommand(app *kingpin.Application) *UpdateCommand {
@@ -281,4 +615,35 @@ func CreateUpdateCommand(app *kingpin.Application) *UpdateCommand {
 		remote:   clause.Arg("remote", "cos file ").Required().String(),
 		authority : clause.Flag("authority", "authority for file : eInvalid / eWRPrivate / eWPrivateRPublic").Short('a').Required().String(),
 	}
-}
\ No newline at end of file
+}
+type SignCommand struct {
+	clause  *kingpin.CmdClause
+	remote  *string
+	expires *time.Duration
+}
+
+func (s *SignCommand) Name() string {
+	return s.clause.FullCommand()
+}
+
+func (s *SignCommand) Execute(ctx context.Context, cosClient *cosclient.CosClient) {
+	url, err := cosClient.PresignGetContext(ctx, *s.remote, *s.expires)
+	e := newEvent("sign", *s.remote, err)
+	if err == nil {
+		e.Info = map[string]string{"url": url, "expires": time.Now().Add(*s.expires).Format(time.RFC3339)}
+		e.Text = url + "\n"
+	}else{
+		e.Text = fmt.Sprintf("[failre  %s] - %s\r\n", *s.remote, err)
+	}
+	report(e)
+}
+
+func CreateSignCommand(app *kingpin.Application) *SignCommand {
+	clause := app.Command("sign", "print a time-limited download url of a private file.")
+
+	return &SignCommand{
+		clause:clause,
+		remote: clause.Arg("remote", "cos file").Required().String(),
+		expires: clause.Flag("expires", "how long the url is valid, e.g. 30m or 24h").Short('e').Default("1h").Duration(),
+	}
+}
@@ -0,0 +1,536 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"gocos/cosclient"
+	"gocos/cosfake"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// exitCalled is what the replaced osExit panics with.
+type exitCalled int
+
+// capture runs fn as a command of gocos and returns what it printed to stdout and the
+// exit code gocos would end with.
+func capture(t *testing.T, fn func()) (string, int) {
+	t.Helper()
+	dir := t.TempDir()
+	stdout, err := os.Create(filepath.Join(dir, "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdout.Close()
+	stderr, err := os.Create(filepath.Join(dir, "stderr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stderr.Close()
+
+	savedStdout, savedStderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = stdout, stderr
+	osExit = func(code int) { panic(exitCalled(code)) }
+	defer func() {
+		os.Stdout, os.Stderr = savedStdout, savedStderr
+		osExit = os.Exit
+	}()
+
+	outcomes.ok, outcomes.failed, outcomes.auth, outcomes.notFound = 0, 0, 0, 0
+	code := func() (code int) {
+		defer func() {
+			if e := recover(); e != nil {
+				exit, ok := e.(exitCalled)
+				if !ok {
+					panic(e)
+				}
+				code = int(exit)
+			}
+		}()
+		fn()
+		return ExitCode()
+	}()
+
+	if errors, _ := ioutil.ReadFile(stderr.Name()); len(errors) > 0 {
+		t.Logf("stderr:\n%s", errors)
+	}
+	out, err := ioutil.ReadFile(stdout.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out), code
+}
+
+// run parses args like gocos does and executes the command with client.
+func run(t *testing.T, client *cosclient.CosClient, args ...string) (string, int) {
+	t.Helper()
+	app := kingpin.New("gocos", "")
+	output := app.Flag("output", "").Short('o').Default("text").Enum("text", "json", "ndjson")
+	commands := []Command{
+		CreateListCommand(app),
+		CreateStatCommand(app),
+		CreatePullCommand(app),
+		CreatePushCommand(app),
+		CreateRmCommand(app),
+		CreateMvCommand(app),
+		CreateCatCommand(app),
+		CreateUpdateCommand(app),
+		CreateSyncCommand(app),
+		CreateSignCommand(app),
+	}
+	command, err := app.Parse(args)
+	if err != nil {
+		t.Fatalf("gocos %s: %s", strings.Join(args, " "), err)
+	}
+	return capture(t, func() {
+		SetOutput(*output)
+		for _, c := range commands {
+			if c.Name() == command {
+				c.Execute(context.Background(), client)
+			}
+		}
+		CloseOutput()
+	})
+}
+
+func expectCode(t *testing.T, args []string, code, expected int) {
+	t.Helper()
+	if code != expected {
+		t.Errorf("gocos %s: exit code %d, expected %d", strings.Join(args, " "), code, expected)
+	}
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestList(t *testing.T) {
+	server := cosfake.New()
+	defer server.Close()
+	server.PageSize = 2
+	server.Put("/docs/a.txt", []byte("a"))
+	server.Put("/docs/b.txt", []byte("bbbbbbbbbb"))
+	server.Put("/docs/sub/c.txt", []byte("ccc"))
+	client := server.Client()
+
+	for _, c := range []struct {
+		args     []string
+		expected string
+		code     int
+	}{
+		{[]string{"ls", "/docs/"}, "a.txt\nb.txt\nsub/\n", EXIT_OK},
+		{[]string{"ls", "-R", "/docs/"}, "a.txt\nb.txt\nsub/\nsub/c.txt\n", EXIT_OK},
+		{[]string{"ls", "--sort", "size", "-r", "/docs/"}, "b.txt\na.txt\nsub/\n", EXIT_OK},
+		{[]string{"ls", "-R", "--exclude", "*.txt", "/docs/"}, "sub/\n", EXIT_OK},
+		{[]string{"ls", "/missing/"}, "", EXIT_NOT_FOUND},
+	} {
+		out, code := run(t, client, c.args...)
+		expectCode(t, c.args, code, c.code)
+		if out != c.expected {
+			t.Errorf("gocos %s printed %q, expected %q", strings.Join(c.args, " "), out, c.expected)
+		}
+	}
+
+	out, _ := run(t, client, "-o", "ndjson", "ls", "/docs/")
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	var events []Event
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("invalid ndjson line %q: %s", scanner.Text(), err)
+		}
+		events = append(events, e)
+	}
+	if len(events) != 3 || events[1].Op != "ls" || events[1].Path != "/docs/b.txt" || events[1].Bytes != 10 || events[1].Status != STATUS_OK {
+		t.Errorf("unexpected ndjson events %+v", events)
+	}
+}
+
+func TestEarlyFailureEvents(t *testing.T) {
+	server := cosfake.New()
+	defer server.Close()
+	client := server.Client()
+
+	for _, c := range []struct {
+		args []string
+		op   string
+		path string
+		code int
+	}{
+		{[]string{"-o", "ndjson", "stat", "/missing.txt"}, "stat", "/missing.txt", cosclient.CODE_NOT_FOUND},
+		{[]string{"-o", "ndjson", "ls", "/missing/"}, "ls", "/missing/", cosclient.CODE_NOT_FOUND},
+		{[]string{"-o", "ndjson", "cat", "/missing.txt"}, "cat", "/missing.txt", http.StatusNotFound},
+		{[]string{"-o", "ndjson", "push", "/nonexistent/file", "/x"}, "push", "/nonexistent/file", 0},
+		{[]string{"-o", "json", "stat", "/missing.txt"}, "stat", "/missing.txt", cosclient.CODE_NOT_FOUND},
+	} {
+		out, code := run(t, client, c.args...)
+		expectCode(t, c.args, code, EXIT_NOT_FOUND)
+		var events []Event
+		if c.args[1] == "json" {
+			json.Unmarshal([]byte(out), &events)
+		} else {
+			var e Event
+			json.Unmarshal([]byte(out), &e)
+			events = append(events, e)
+		}
+		if len(events) != 1 || events[0].Op != c.op || events[0].Path != c.path || events[0].Status != STATUS_FAILED ||
+			events[0].Code != c.code || events[0].Error == "" {
+			t.Errorf("gocos %s printed %q", strings.Join(c.args, " "), out)
+		}
+	}
+}
+
+func TestRetryEvents(t *testing.T) {
+	server := cosfake.New()
+	defer server.Close()
+	server.Put("/a.txt", []byte("hello"))
+	client := server.Client()
+	client.Retry = &cosclient.RetryPolicy{MaxAttempts: 2}
+	client.OnRetry = ReportRetry
+	failed := false
+	client.Middleware = []cosclient.Middleware{func(next http.RoundTripper) http.RoundTripper {
+		return cosclient.RoundTripperFunc(func(request *http.Request) (*http.Response, error) {
+			if !failed {
+				failed = true
+				return &http.Response{StatusCode: http.StatusServiceUnavailable, Status: "503 Service Unavailable",
+					Body: http.NoBody, Request: request}, nil
+			}
+			return next.RoundTrip(request)
+		})
+	}}
+
+	args := []string{"-o", "ndjson", "stat", "/a.txt"}
+	out, code := run(t, client, args...)
+	expectCode(t, args, code, EXIT_OK)
+	var events []Event
+	decoder := json.NewDecoder(strings.NewReader(out))
+	for decoder.More() {
+		var e Event
+		if err := decoder.Decode(&e); err != nil {
+			t.Fatalf("invalid ndjson %q: %s", out, err)
+		}
+		events = append(events, e)
+	}
+	if len(events) != 2 || events[0].Op != "retry" || !strings.HasSuffix(events[0].Path, "/a.txt") || events[0].Status != STATUS_RETRY ||
+		events[0].Attempt != 1 || events[0].Code != http.StatusServiceUnavailable || events[1].Status != STATUS_OK {
+		t.Errorf("gocos %s printed %q", strings.Join(args, " "), out)
+	}
+}
+
+func TestListAuthFailure(t *testing.T) {
+	server := cosfake.New()
+	defer server.Close()
+	client := server.Client()
+	client.SecretKey = "wrong"
+
+	args := []string{"ls", "/"}
+	_, code := run(t, client, args...)
+	expectCode(t, args, code, EXIT_AUTH)
+}
+
+func TestStat(t *testing.T) {
+	server := cosfake.New()
+	defer server.Close()
+	server.Put("/a.txt", []byte("hello"))
+	client := server.Client()
+	sum := sha1.Sum([]byte("hello"))
+
+	args := []string{"stat", "-f", "{{.FileSize}} {{.Sha}}", "/a.txt"}
+	out, code := run(t, client, args...)
+	expectCode(t, args, code, EXIT_OK)
+	if expected := "5 " + hex.EncodeToString(sum[:]); out != expected {
+		t.Errorf("stat printed %q, expected %q", out, expected)
+	}
+
+	// the field paths of the raw response earlier versions formatted
+	args = []string{"stat", "-f", "{{.code}} {{.data.filesize}} {{.data.sha}}", "/a.txt"}
+	out, code = run(t, client, args...)
+	expectCode(t, args, code, EXIT_OK)
+	if expected := "0 5 " + hex.EncodeToString(sum[:]); out != expected {
+		t.Errorf("stat printed %q, expected %q", out, expected)
+	}
+
+	args = []string{"stat", "/missing.txt"}
+	_, code = run(t, client, args...)
+	expectCode(t, args, code, EXIT_NOT_FOUND)
+}
+
+func TestPushPull(t *testing.T) {
+	server := cosfake.New()
+	defer server.Close()
+	client := server.Client()
+	client.CheckpointDir = t.TempDir()
+
+	big := bytes.Repeat([]byte("0123456789abcdef"), int(cosclient.MAX_SINGLE_SIZE/16)+100)
+	files := map[string][]byte{
+		"a.txt":     []byte("a"),
+		"sub/b.txt": []byte("bb"),
+		"big.bin":   big,
+	}
+	local := t.TempDir()
+	for name, data := range files {
+		writeFile(t, filepath.Join(local, filepath.FromSlash(name)), data)
+	}
+
+	args := []string{"push", "-j", "2", "--part-size", "2M", "--part-concurrency", "3", local, "/up/"}
+	_, code := run(t, client, args...)
+	expectCode(t, args, code, EXIT_OK)
+	for name, data := range files {
+		if remote, ok := server.Get("/up/" + name); !ok || !bytes.Equal(remote, data) {
+			t.Errorf("/up/%s not pushed", name)
+		}
+	}
+
+	args = []string{"push", filepath.Join(local, "a.txt"), "/up/a.txt"}
+	_, code = run(t, client, args...)
+	expectCode(t, args, code, EXIT_FAILURE)
+
+	writeFile(t, filepath.Join(local, "a.txt"), []byte("changed"))
+	args = []string{"push", "-f", filepath.Join(local, "a.txt"), "/up/a.txt"}
+	_, code = run(t, client, args...)
+	expectCode(t, args, code, EXIT_OK)
+	if remote, _ := server.Get("/up/a.txt"); string(remote) != "changed" {
+		t.Errorf("push -f left %q", remote)
+	}
+	files["a.txt"] = []byte("changed")
+
+	args = []string{"push", local, "/up"}
+	_, code = run(t, client, args...)
+	expectCode(t, args, code, EXIT_USAGE)
+
+	args = []string{"push", "-f", "--part-size", "5M", local, "/up/"}
+	_, code = run(t, client, args...)
+	expectCode(t, args, code, EXIT_USAGE)
+
+	args = []string{"push", "-f", "--part-size", "big", local, "/up/"}
+	_, code = run(t, client, args...)
+	expectCode(t, args, code, EXIT_USAGE)
+	client.UploadPartSize = 0
+
+	for _, partSize := range []string{"0", "1048576"} {
+		target := t.TempDir() + string(os.PathSeparator)
+		args = []string{"pull", "-j", "2", "--part-size", partSize, "/up/", target}
+		_, code = run(t, client, args...)
+		expectCode(t, args, code, EXIT_OK)
+		for name, data := range files {
+			pulled, err := ioutil.ReadFile(filepath.Join(target, filepath.FromSlash(name)))
+			if err != nil || !bytes.Equal(pulled, data) {
+				t.Errorf("pull --part-size %s: %s not pulled: %v", partSize, name, err)
+			}
+		}
+	}
+
+	args = []string{"pull", "/up/missing.txt", filepath.Join(t.TempDir(), "missing.txt")}
+	_, code = run(t, client, args...)
+	expectCode(t, args, code, EXIT_NOT_FOUND)
+}
+
+func TestParseSize(t *testing.T) {
+	for _, c := range []struct {
+		value    string
+		expected int64
+	}{
+		{"1048576", 1048576},
+		{"512K", 512 * 1024},
+		{"4m", 4 << 20},
+		{"4MB", 4 << 20},
+		{"1.5G", 3 << 29},
+	} {
+		if size, err := ParseSize(c.value); err != nil || size != c.expected {
+			t.Errorf("ParseSize(%q) = %d, %v, expected %d", c.value, size, err, c.expected)
+		}
+	}
+	for _, value := range []string{"", "M", "-1", "4X"} {
+		if _, err := ParseSize(value); err == nil {
+			t.Errorf("ParseSize(%q) accepted", value)
+		}
+	}
+}
+
+func TestPushStdin(t *testing.T) {
+	server := cosfake.New()
+	defer server.Close()
+
+	input := filepath.Join(t.TempDir(), "input")
+	writeFile(t, input, []byte("from stdin"))
+	stdin, err := os.Open(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	saved := os.Stdin
+	os.Stdin = stdin
+	defer func() { os.Stdin = saved }()
+
+	args := []string{"-o", "json", "push", "-", "/stdin.txt"}
+	out, code := run(t, server.Client(), args...)
+	expectCode(t, args, code, EXIT_OK)
+	if remote, _ := server.Get("/stdin.txt"); string(remote) != "from stdin" {
+		t.Errorf("pushed %q from stdin", remote)
+	}
+	var events []Event
+	if err := json.Unmarshal([]byte(out), &events); err != nil || len(events) != 1 || events[0].Bytes != int64(len("from stdin")) {
+		t.Errorf("push from stdin reported %s: %v", out, err)
+	}
+}
+
+func TestRm(t *testing.T) {
+	server := cosfake.New()
+	defer server.Close()
+	server.Put("/d/a.txt", []byte("a"))
+	server.Put("/d/e/b.txt", []byte("b"))
+	server.Put("/keep.txt", []byte("k"))
+	client := server.Client()
+
+	for _, c := range []struct {
+		args  []string
+		code  int
+		paths []string
+	}{
+		{[]string{"rm", "/d/"}, EXIT_USAGE, []string{"/d/", "/d/a.txt", "/d/e/", "/d/e/b.txt", "/keep.txt"}},
+		{[]string{"rm", "-r", "/d/"}, EXIT_FAILURE, []string{"/d/", "/d/a.txt", "/d/e/", "/d/e/b.txt", "/keep.txt"}},
+		{[]string{"rm", "-r", "-f", "--exclude", "b.txt", "/d/"}, EXIT_OK, []string{"/d/", "/d/e/", "/d/e/b.txt", "/keep.txt"}},
+		{[]string{"rm", "-rf", "/d/"}, EXIT_OK, []string{"/keep.txt"}},
+		{[]string{"rm", "/missing.txt"}, EXIT_NOT_FOUND, []string{"/keep.txt"}},
+		{[]string{"rm", "/keep.txt"}, EXIT_OK, []string{}},
+	} {
+		_, code := run(t, client, c.args...)
+		expectCode(t, c.args, code, c.code)
+		if paths := server.Paths(); !reflect.DeepEqual(paths, c.paths) {
+			t.Errorf("after gocos %s the bucket holds %v, expected %v", strings.Join(c.args, " "), paths, c.paths)
+		}
+	}
+}
+
+func TestMv(t *testing.T) {
+	server := cosfake.New()
+	defer server.Close()
+	server.Put("/a.txt", []byte("a"))
+	server.Put("/b.txt", []byte("b"))
+	client := server.Client()
+
+	for _, c := range []struct {
+		args  []string
+		code  int
+		paths []string
+	}{
+		{[]string{"mv", "/a.txt", "/dir/c.txt"}, EXIT_OK, []string{"/b.txt", "/dir/", "/dir/c.txt"}},
+		{[]string{"mv", "/b.txt", "/dir/c.txt"}, EXIT_FAILURE, []string{"/b.txt", "/dir/", "/dir/c.txt"}},
+		{[]string{"mv", "-f", "/b.txt", "/dir/c.txt"}, EXIT_OK, []string{"/dir/", "/dir/c.txt"}},
+		{[]string{"mv", "/dir/", "/other"}, EXIT_USAGE, []string{"/dir/", "/dir/c.txt"}},
+		{[]string{"mv", "/missing.txt", "/x.txt"}, EXIT_NOT_FOUND, []string{"/dir/", "/dir/c.txt"}},
+	} {
+		_, code := run(t, client, c.args...)
+		expectCode(t, c.args, code, c.code)
+		if paths := server.Paths(); !reflect.DeepEqual(paths, c.paths) {
+			t.Errorf("after gocos %s the bucket holds %v, expected %v", strings.Join(c.args, " "), paths, c.paths)
+		}
+	}
+	if data, _ := server.Get("/dir/c.txt"); string(data) != "b" {
+		t.Errorf("mv -f left %q", data)
+	}
+}
+
+func TestCat(t *testing.T) {
+	server := cosfake.New()
+	defer server.Close()
+	server.Put("/a.txt", []byte("0123456789"))
+	server.Put("/b.txt", []byte("abc"))
+	client := server.Client()
+
+	for _, c := range []struct {
+		args     []string
+		expected string
+		code     int
+	}{
+		{[]string{"cat", "/a.txt", "/b.txt"}, "0123456789abc", EXIT_OK},
+		{[]string{"cat", "--range", "2-4", "/a.txt"}, "234", EXIT_OK},
+		{[]string{"cat", "--head", "3", "/a.txt"}, "012", EXIT_OK},
+		{[]string{"cat", "--tail", "2", "/a.txt"}, "89", EXIT_OK},
+		{[]string{"cat", "--head", "1", "--tail", "1", "/a.txt"}, "", EXIT_USAGE},
+		{[]string{"cat", "--range", "x", "/a.txt"}, "", EXIT_USAGE},
+		{[]string{"cat", "/missing.txt"}, "", EXIT_NOT_FOUND},
+	} {
+		out, code := run(t, client, c.args...)
+		expectCode(t, c.args, code, c.code)
+		if out != c.expected {
+			t.Errorf("gocos %s printed %q, expected %q", strings.Join(c.args, " "), out, c.expected)
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	server := cosfake.New()
+	defer server.Close()
+	server.Put("/a.txt", []byte("a"))
+	client := server.Client()
+
+	args := []string{"update", "-a", "eWPrivateRPublic", "/a.txt"}
+	_, code := run(t, client, args...)
+	expectCode(t, args, code, EXIT_OK)
+	if authority := server.Authority("/a.txt"); authority != "eWPrivateRPublic" {
+		t.Errorf("authority is %s after update", authority)
+	}
+
+	args = []string{"update", "-a", "bogus", "/a.txt"}
+	_, code = run(t, client, args...)
+	expectCode(t, args, code, EXIT_FAILURE)
+
+	args = []string{"update", "-a", "eWRPrivate", "/missing.txt"}
+	_, code = run(t, client, args...)
+	expectCode(t, args, code, EXIT_NOT_FOUND)
+}
+
+func TestSign(t *testing.T) {
+	server := cosfake.New()
+	defer server.Close()
+	client := server.Client()
+
+	for _, name := range []string{"/a b.txt", "/a#b.txt", "/a?b.txt", "/100%.txt", "/dir/%41.txt"} {
+		server.Put(name, []byte("signed "+name))
+
+		args := []string{"sign", "-e", "10m", name}
+		out, code := run(t, client, args...)
+		expectCode(t, args, code, EXIT_OK)
+		url := strings.TrimSpace(out)
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || string(body) != "signed "+name {
+			t.Errorf("GET %s: %s %q", url, resp.Status, body)
+		}
+
+		resp, err = http.Get(url[:strings.LastIndex(url, "?")])
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("GET %s without signature: %s", name, resp.Status)
+		}
+	}
+
+	args := []string{"sign", "/dir/"}
+	_, code := run(t, client, args...)
+	expectCode(t, args, code, EXIT_FAILURE)
+}
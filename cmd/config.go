@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"gocos/config"
+	"strings"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// ConfigCommand edits the profiles of the config file. Unlike the other commands it runs
+// without a client, so it is not a Command.
+type ConfigCommand struct {
+	clause     *kingpin.CmdClause
+	set        *kingpin.CmdClause
+	setKey     *string
+	setValue   *string
+	unset      *kingpin.CmdClause
+	unsetKey   *string
+	get        *kingpin.CmdClause
+	getKey     *string
+	list       *kingpin.CmdClause
+	use        *kingpin.CmdClause
+	useProfile *string
+}
+
+// Handles reports whether command is one of the config subcommands.
+func (c *ConfigCommand) Handles(command string) bool {
+	return strings.HasPrefix(command, c.clause.FullCommand()+" ")
+}
+
+// Run executes the config subcommand on file; profile is the --profile flag, empty for
+// the current profile.
+func (c *ConfigCommand) Run(file *config.File, profile string, command string) {
+	name := file.ProfileName(profile)
+	switch command {
+	case c.set.FullCommand():
+		exitUsageIfErr(file.Set(name, *c.setKey, *c.setValue))
+		exitIfErr(file.Save())
+	case c.unset.FullCommand():
+		exitUsageIfErr(file.Unset(name, *c.unsetKey))
+		exitIfErr(file.Save())
+	case c.get.FullCommand():
+		value, err := file.Get(name, *c.getKey)
+		exitIfErr(err)
+		var s string
+		if json.Unmarshal(value, &s) == nil {
+			fmt.Println(s)
+		} else {
+			fmt.Println(string(value))
+		}
+	case c.list.FullCommand():
+		current := file.ProfileName("")
+		for _, p := range file.Names() {
+			mark := " "
+			if p == current {
+				mark = "*"
+			}
+			fmt.Printf("%s %s\n", mark, p)
+		}
+	case c.use.FullCommand():
+		exitUsageIfErr(file.Use(*c.useProfile))
+		exitIfErr(file.Save())
+	}
+}
+
+func exitUsageIfErr(e error) {
+	if e != nil {
+		exitUsage(e)
+	}
+}
+
+func CreateConfigCommand(app *kingpin.Application) *ConfigCommand {
+	clause := app.Command("config", "edit the profiles of the config file.")
+	set := clause.Command("set", "set a value of the profile, the current one unless --profile is given.")
+	unset := clause.Command("unset", "remove a value from the profile.")
+	get := clause.Command("get", "print a value set by the profile.")
+	use := clause.Command("use", "make a profile the current one.")
+
+	return &ConfigCommand{
+		clause:     clause,
+		set:        set,
+		setKey:     set.Arg("key", "config key, e.g. Bucket").Required().String(),
+		setValue:   set.Arg("value", "value, parsed as JSON when possible").Required().String(),
+		unset:      unset,
+		unsetKey:   unset.Arg("key", "config key").Required().String(),
+		get:        get,
+		getKey:     get.Arg("key", "config key").Required().String(),
+		list:       clause.Command("list", "list the profiles, marking the current one."),
+		use:        use,
+		useProfile: use.Arg("profile", "profile name").Required().String(),
+	}
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"gocos/config"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// runConfig executes a config subcommand on the config file at path.
+func runConfig(t *testing.T, path string, args ...string) (string, int) {
+	t.Helper()
+	app := kingpin.New("gocos", "")
+	profile := app.Flag("profile", "").String()
+	configCommand := CreateConfigCommand(app)
+	command, err := app.Parse(args)
+	if err != nil {
+		t.Fatalf("gocos %s: %s", strings.Join(args, " "), err)
+	}
+	file, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return capture(t, func() {
+		configCommand.Run(file, *profile, command)
+	})
+}
+
+func TestConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cos.config.json")
+
+	for _, c := range []struct {
+		args     []string
+		expected string
+		code     int
+	}{
+		{[]string{"config", "set", "bucket", "photos"}, "", EXIT_OK},
+		{[]string{"--profile", "prod", "config", "set", "Bucket", "prod-photos"}, "", EXIT_OK},
+		{[]string{"config", "set", "NoSuchKey", "x"}, "", EXIT_USAGE},
+		{[]string{"config", "get", "Bucket"}, "photos\n", EXIT_OK},
+		{[]string{"config", "use", "prod"}, "", EXIT_OK},
+		{[]string{"config", "get", "Bucket"}, "prod-photos\n", EXIT_OK},
+		{[]string{"config", "list"}, "  default\n* prod\n", EXIT_OK},
+		{[]string{"config", "unset", "Bucket"}, "", EXIT_OK},
+		{[]string{"config", "get", "Bucket"}, "", EXIT_FAILURE},
+		{[]string{"config", "use", "staging"}, "", EXIT_USAGE},
+	} {
+		out, code := runConfig(t, path, c.args...)
+		expectCode(t, c.args, code, c.code)
+		if out != c.expected {
+			t.Errorf("gocos %s printed %q, expected %q", strings.Join(c.args, " "), out, c.expected)
+		}
+	}
+}
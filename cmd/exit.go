@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"gocos/cosclient"
+	"os"
+	"sync"
+)
+
+// Process exit codes of gocos.
+const (
+	EXIT_OK          = 0
+	EXIT_FAILURE     = 1
+	EXIT_USAGE       = 2
+	EXIT_PARTIAL     = 3
+	EXIT_AUTH        = 4
+	EXIT_NOT_FOUND   = 5
+	EXIT_INTERRUPTED = 130
+)
+
+// outcomes counts the events reported by the running command.
+var outcomes = struct {
+	mu       sync.Mutex
+	ok       int
+	failed   int
+	auth     int
+	notFound int
+}{}
+
+// report tallies e for the exit code and hands it to the reporter.
+func report(e *Event) {
+	outcomes.mu.Lock()
+	if e.Status == STATUS_FAILED {
+		outcomes.failed++
+		switch exitCode(e.err) {
+		case EXIT_AUTH:
+			outcomes.auth++
+		case EXIT_NOT_FOUND:
+			outcomes.notFound++
+		}
+	} else {
+		outcomes.ok++
+	}
+	outcomes.mu.Unlock()
+	if view != nil {
+		view.print(func() { reporter.Report(e) })
+	} else {
+		reporter.Report(e)
+	}
+}
+
+// hasFailures reports whether a failed event has been reported.
+func hasFailures() bool {
+	outcomes.mu.Lock()
+	defer outcomes.mu.Unlock()
+	return outcomes.failed > 0
+}
+
+// ExitCode returns the exit code summarizing the reported events: EXIT_PARTIAL when only
+// some objects failed, EXIT_AUTH or EXIT_NOT_FOUND when every failure had that cause and
+// EXIT_FAILURE otherwise.
+func ExitCode() int {
+	outcomes.mu.Lock()
+	defer outcomes.mu.Unlock()
+	switch {
+	case outcomes.failed == 0:
+		return EXIT_OK
+	case outcomes.auth == outcomes.failed:
+		return EXIT_AUTH
+	case outcomes.notFound == outcomes.failed:
+		return EXIT_NOT_FOUND
+	case outcomes.ok > 0:
+		return EXIT_PARTIAL
+	default:
+		return EXIT_FAILURE
+	}
+}
+
+// exitCode classifies the error of a failed operation.
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return EXIT_OK
+	case cosclient.IsAuthError(err):
+		return EXIT_AUTH
+	case cosclient.IsNotFound(err):
+		return EXIT_NOT_FOUND
+	case errors.Is(err, os.ErrNotExist):
+		return EXIT_NOT_FOUND
+	default:
+		return EXIT_FAILURE
+	}
+}
+
+func exitIfErr(e error) {
+	if e != nil {
+		exit(exitCode(e), e)
+	}
+}
+
+// exitFailed ends a command whose op on path failed before it could report the objects
+// concerned. The failure is reported as an event first, so structured output records it
+// like any other, and the exit code follows from err.
+func exitFailed(op, path string, err error) {
+	if err == nil {
+		return
+	}
+	e := newEvent(op, path, err)
+	e.Text = fmt.Sprintf("%s\n", err)
+	report(e)
+	exit(exitCode(err), nil)
+}
+
+// exitUsage ends a command started with invalid arguments.
+func exitUsage(e error) {
+	exit(EXIT_USAGE, e)
+}
+
+// osExit ends the process, tests replace it to observe the exit code.
+var osExit = os.Exit
+
+func exit(code int, e error) {
+	CloseOutput()
+	if e != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", e)
+	}
+	osExit(code)
+}
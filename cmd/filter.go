@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"gocos/cosclient"
+	"gocos/filter"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// filterFlags are the --include, --exclude and --exclude-from flags of recursive commands.
+type filterFlags struct {
+	include     *[]string
+	exclude     *[]string
+	excludeFrom *[]string
+}
+
+func addFilterFlags(clause *kingpin.CmdClause) *filterFlags {
+	return &filterFlags{
+		include:     clause.Flag("include", "only act on paths matching this gitignore-style pattern, repeatable").PlaceHolder("PATTERN").Strings(),
+		exclude:     clause.Flag("exclude", "skip paths matching this gitignore-style pattern, repeatable").PlaceHolder("PATTERN").Strings(),
+		excludeFrom: clause.Flag("exclude-from", "read exclude patterns from a gitignore-style file, repeatable").PlaceHolder("FILE").Strings(),
+	}
+}
+
+// build returns the filter of the flags, nil when none was given.
+func (f *filterFlags) build() *filter.Filter {
+	if len(*f.include) == 0 && len(*f.exclude) == 0 && len(*f.excludeFrom) == 0 {
+		return nil
+	}
+	flt := filter.New(*f.include, *f.exclude)
+	for _, name := range *f.excludeFrom {
+		exitIfErr(flt.AddExcludeFile(name))
+	}
+	return flt
+}
+
+// pathFilter returns the filter of the flags for cosclient, nil when none was given.
+func (f *filterFlags) pathFilter() cosclient.PathFilter {
+	flt := f.build()
+	if flt == nil {
+		return nil
+	}
+	return flt.Match
+}
@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"fmt"
+	"gocos/cosclient"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// PROGRESS_REFRESH is how often the bars are redrawn on a terminal.
+	PROGRESS_REFRESH = 200 * time.Millisecond
+	// PROGRESS_LOG_INTERVAL is how often a progress line is logged when stderr is not a terminal.
+	PROGRESS_LOG_INTERVAL = 5 * time.Second
+	// PROGRESS_MAX_BARS is how many transfers get their own bar, the others only count in the total.
+	PROGRESS_MAX_BARS = 5
+)
+
+// progressView renders the transfers of the running command on stderr: a bar per transfer
+// and one for the total on a terminal, or a line per transfer every PROGRESS_LOG_INTERVAL
+// otherwise.
+type progressView struct {
+	mu        sync.Mutex
+	out       io.Writer
+	tty       bool
+	start     time.Time
+	transfers map[*transfer]bool
+	active    []*transfer
+	keys      map[string]*transfer
+	files     int
+	finished  int
+	lines     int
+	stop      chan struct{}
+	stopped   sync.WaitGroup
+}
+
+// transfer is the progress of one file.
+type transfer struct {
+	progress cosclient.Progress
+	start    time.Time
+}
+
+var view *progressView
+
+// ShowProgress renders the uploads and downloads of client on stderr until CloseOutput.
+func ShowProgress(client *cosclient.CosClient) {
+	fi, err := os.Stderr.Stat()
+	tty := err == nil && fi.Mode()&os.ModeCharDevice != 0 && os.Getenv("TERM") != "dumb"
+	view = newProgressView(os.Stderr, tty)
+	client.OnProgress = view.update
+	interval := PROGRESS_LOG_INTERVAL
+	if tty {
+		interval = PROGRESS_REFRESH
+	}
+	view.run(interval)
+}
+
+func newProgressView(out io.Writer, tty bool) *progressView {
+	return &progressView{
+		out:       out,
+		tty:       tty,
+		start:     time.Now(),
+		transfers: map[*transfer]bool{},
+		keys:      map[string]*transfer{},
+		stop:      make(chan struct{}),
+	}
+}
+
+// update records a report of the client, it is a CosClient.OnProgress.
+func (v *progressView) update(p cosclient.Progress) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	key := p.Op + "\x00" + p.Local + "\x00" + p.Remote
+	t, ok := v.keys[key]
+	if !ok {
+		t = &transfer{start: time.Now()}
+		v.keys[key] = t
+		v.transfers[t] = true
+		v.active = append(v.active, t)
+		v.files++
+	}
+	t.progress = p
+	if p.Done {
+		delete(v.keys, key)
+		v.finished++
+		for i, a := range v.active {
+			if a == t {
+				v.active = append(v.active[:i], v.active[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+func (v *progressView) run(interval time.Duration) {
+	v.stopped.Add(1)
+	go func() {
+		defer v.stopped.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				v.mu.Lock()
+				v.render(now)
+				v.mu.Unlock()
+			case <-v.stop:
+				return
+			}
+		}
+	}()
+}
+
+// close stops rendering and erases the bars.
+func (v *progressView) close() {
+	close(v.stop)
+	v.stopped.Wait()
+	v.mu.Lock()
+	v.clear()
+	v.mu.Unlock()
+}
+
+// print runs fn, which writes to the terminal, with the bars erased; they are drawn again
+// on the next refresh.
+func (v *progressView) print(fn func()) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.clear()
+	fn()
+}
+
+// clear erases the bars drawn last. The caller must hold mu.
+func (v *progressView) clear() {
+	if v.lines == 0 {
+		return
+	}
+	fmt.Fprintf(v.out, "\x1b[%dA\x1b[J", v.lines)
+	v.lines = 0
+}
+
+// render draws the bars on a terminal, or logs a line per unfinished transfer. The caller
+// must hold mu.
+func (v *progressView) render(now time.Time) {
+	if !v.tty {
+		for _, t := range v.active {
+			fmt.Fprintf(v.out, "[progress] %s\n", t.describe(now, 0))
+		}
+		if len(v.active) > 0 && v.files > 1 {
+			fmt.Fprintf(v.out, "[progress] %s\n", v.total(now, 0))
+		}
+		return
+	}
+
+	v.clear()
+	var b strings.Builder
+	lines := 0
+	for i, t := range v.active {
+		if i == PROGRESS_MAX_BARS {
+			break
+		}
+		b.WriteString(t.describe(now, 40) + "\n")
+		lines++
+	}
+	if len(v.active) > 0 && v.files > 1 {
+		b.WriteString(v.total(now, 40) + "\n")
+		lines++
+	}
+	io.WriteString(v.out, b.String())
+	v.lines = lines
+}
+
+// total describes the bytes of every transfer of the command. The caller must hold mu.
+func (v *progressView) total(now time.Time, width int) string {
+	var bytes, size int64
+	for t := range v.transfers {
+		bytes += t.progress.Bytes
+		size += t.progress.Total
+	}
+	name := fmt.Sprintf("total %d/%d files", v.finished, v.files)
+	return describe(name, bytes, size, now.Sub(v.start), width)
+}
+
+func (t *transfer) describe(now time.Time, width int) string {
+	name := t.progress.Remote
+	if t.progress.Op == cosclient.PROGRESS_UPLOAD {
+		name = "push " + name
+	} else {
+		name = "pull " + name
+	}
+	return describe(name, t.progress.Bytes, t.progress.Total, now.Sub(t.start), width)
+}
+
+// describe formats the progress of bytes out of size after elapsed: the name, a bar of
+// width characters when width > 0, the percentage, sizes, rate and estimated time left.
+func describe(name string, bytes, size int64, elapsed time.Duration, width int) string {
+	percent := 100.0
+	if size > 0 && bytes < size {
+		percent = float64(bytes) * 100 / float64(size)
+	}
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(bytes) / elapsed.Seconds()
+	}
+	eta := "--"
+	if rate > 0 && bytes < size {
+		eta = time.Duration(float64(size-bytes) / rate * float64(time.Second)).Round(time.Second).String()
+	}
+
+	var b strings.Builder
+	if width > 0 {
+		if len(name) > 30 {
+			name = "..." + name[len(name)-27:]
+		}
+		fmt.Fprintf(&b, "%-30s [", name)
+		filled := int(percent / 100 * float64(width))
+		b.WriteString(strings.Repeat("=", filled))
+		b.WriteString(strings.Repeat(" ", width-filled))
+		b.WriteString("] ")
+	} else {
+		b.WriteString(name + " ")
+	}
+	fmt.Fprintf(&b, "%3.0f%% %s/%s %s/s ETA %s", percent, humanSize(bytes), humanSize(size), humanSize(int64(rate)), eta)
+	return b.String()
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"bytes"
+	"gocos/cosclient"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDescribe(t *testing.T) {
+	for _, c := range []struct {
+		bytes, size int64
+		elapsed     time.Duration
+		width       int
+		expected    string
+	}{
+		{0, 2048, 0, 0, "f   0% 0/2.0K 0/s ETA --"},
+		{1024, 2048, time.Second, 0, "f  50% 1.0K/2.0K 1.0K/s ETA 1s"},
+		{2048, 2048, time.Second, 4, "f                              [====] 100% 2.0K/2.0K 2.0K/s ETA --"},
+		{512, 2048, time.Second, 4, "f                              [=   ]  25% 512/2.0K 512/s ETA 3s"},
+	} {
+		if line := describe("f", c.bytes, c.size, c.elapsed, c.width); line != c.expected {
+			t.Errorf("describe(%d, %d, %s, %d) = %q, expected %q", c.bytes, c.size, c.elapsed, c.width, line, c.expected)
+		}
+	}
+}
+
+func TestProgressView(t *testing.T) {
+	var out bytes.Buffer
+	v := newProgressView(&out, false)
+	a := cosclient.Progress{Op: cosclient.PROGRESS_UPLOAD, Local: "a", Remote: "/a", Total: 100}
+	b := cosclient.Progress{Op: cosclient.PROGRESS_DOWNLOAD, Local: "b", Remote: "/b", Total: 100}
+	v.update(a)
+	v.update(b)
+	a.Bytes = 50
+	v.update(a)
+	b.Bytes, b.Done = 100, true
+	v.update(b)
+
+	v.render(time.Now())
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "[progress] push /a  50% ") || !strings.HasPrefix(lines[1], "[progress] total 1/2 files  75% ") {
+		t.Errorf("logged %q", lines)
+	}
+
+	out.Reset()
+	v.tty = true
+	v.render(time.Now())
+	v.print(func() { out.WriteString("event\n") })
+	if drawn := out.String(); strings.Count(drawn, "\n") != 3 || !strings.Contains(drawn, "\x1b[2A\x1b[Jevent\n") {
+		t.Errorf("drew %q", drawn)
+	}
+}
@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"testing"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+func TestPushFromStdin(t *testing.T) {
+	for _, c := range []struct {
+		args     []string
+		expected bool
+	}{
+		{[]string{"push", "-", "/x.txt"}, true},
+		{[]string{"push", "x.txt", "/x.txt"}, false},
+	} {
+		app := kingpin.New("gocos", "")
+		push := CreatePushCommand(app)
+		if _, err := app.Parse(c.args); err != nil {
+			t.Fatal(err)
+		}
+		if push.fromStdin() != c.expected {
+			t.Errorf("%v: fromStdin() = %v, expected %v", c.args, !c.expected, c.expected)
+		}
+	}
+}
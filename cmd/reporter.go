@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gocos/cosclient"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	STATUS_OK      = "ok"
+	STATUS_FAILED  = "failed"
+	STATUS_DRY_RUN = "dry-run"
+	STATUS_RETRY   = "retry"
+)
+
+// Event is the outcome of one operation on one object.
+type Event struct {
+	Op       string      `json:"op"`
+	Path     string      `json:"path"`
+	Target   string      `json:"target,omitempty"`
+	Bytes    int64       `json:"bytes,omitempty"`
+	Duration float64     `json:"duration,omitempty"`
+	Status   string      `json:"status"`
+	Attempt  int         `json:"attempt,omitempty"`
+	Code     int         `json:"code,omitempty"`
+	Error    string      `json:"error,omitempty"`
+	Info     interface{} `json:"info,omitempty"`
+
+	// Text is what the text output prints for the event.
+	Text string `json:"-"`
+
+	err error
+}
+
+// newEvent returns the event of op on path finished with err, which fills Status, Code and Error.
+// Code is the cos error code, or the HTTP status when the service answered without one.
+func newEvent(op, path string, err error) *Event {
+	e := &Event{Op: op, Path: path, Status: STATUS_OK, err: err}
+	if err != nil {
+		e.Status = STATUS_FAILED
+		e.Error = err.Error()
+		var cosErr *cosclient.CosError
+		var statusErr *cosclient.StatusError
+		if errors.As(err, &cosErr) {
+			e.Code = cosErr.Code
+		} else if errors.As(err, &statusErr) {
+			e.Code = statusErr.StatusCode
+		}
+	}
+	return e
+}
+
+// since sets Duration to the seconds elapsed since start.
+func (e *Event) since(start time.Time) *Event {
+	e.Duration = time.Since(start).Seconds()
+	return e
+}
+
+// Reporter receives the events of a command; it is safe for concurrent use.
+type Reporter interface {
+	Report(e *Event)
+	Close()
+}
+
+var reporter Reporter = &textReporter{}
+
+// SetOutput selects the reporter of the --output format: text, json or ndjson.
+func SetOutput(format string) {
+	switch format {
+	case "json":
+		reporter = &jsonReporter{}
+	case "ndjson":
+		reporter = &ndjsonReporter{encoder: json.NewEncoder(os.Stdout)}
+	default:
+		reporter = &textReporter{}
+	}
+}
+
+// CloseOutput erases the progress bars and flushes the events buffered by the reporter.
+func CloseOutput() {
+	if view != nil {
+		view.close()
+		view = nil
+	}
+	reporter.Close()
+}
+
+// textReporter prints the Text of events, failures and retries to stderr.
+type textReporter struct {
+	mu sync.Mutex
+}
+
+func (r *textReporter) Report(e *Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e.Status == STATUS_FAILED || e.Status == STATUS_RETRY {
+		fmt.Fprint(os.Stderr, e.Text)
+	} else {
+		fmt.Print(e.Text)
+	}
+}
+
+func (r *textReporter) Close() {
+}
+
+// ndjsonReporter prints every event as one line of JSON as soon as it is reported.
+type ndjsonReporter struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+func (r *ndjsonReporter) Report(e *Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.encoder.Encode(e)
+}
+
+func (r *ndjsonReporter) Close() {
+}
+
+// jsonReporter prints all events as one JSON array when closed.
+type jsonReporter struct {
+	mu     sync.Mutex
+	events []*Event
+}
+
+func (r *jsonReporter) Report(e *Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+func (r *jsonReporter) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	events := r.events
+	if events == nil {
+		events = []*Event{}
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(events)
+}
@@ -0,0 +1,230 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gocos/cosclient"
+	"gocos/filter"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// cosPrefix marks a sync argument as a path on cos.
+const cosPrefix = "cos:"
+
+type SyncCommand struct {
+	clause   *kingpin.CmdClause
+	src      *string
+	dst      *string
+	delete   *bool
+	dryRun   *bool
+	checksum *bool
+	filter   *filterFlags
+}
+
+// syncEntry is what sync compares for a file on either side.
+type syncEntry struct {
+	size  int64
+	mtime int64
+	sha   string
+}
+
+func (s *SyncCommand) Name() string {
+	return s.clause.FullCommand()
+}
+
+func (s *SyncCommand) Execute(ctx context.Context, cosClient *cosclient.CosClient) {
+	srcRemote := strings.HasPrefix(*s.src, cosPrefix)
+	dstRemote := strings.HasPrefix(*s.dst, cosPrefix)
+	if srcRemote == dstRemote {
+		exitUsage(errors.New("sync needs one local path and one cos: path"))
+	}
+
+	var local, remote string
+	if srcRemote {
+		local, remote = *s.dst, strings.TrimPrefix(*s.src, cosPrefix)
+	} else {
+		local, remote = *s.src, strings.TrimPrefix(*s.dst, cosPrefix)
+	}
+	if !strings.HasSuffix(remote, "/") {
+		remote += "/"
+	}
+	f := s.filter.build()
+	remoteFiles, err := listRemote(ctx, cosClient, f, remote)
+	if cosclient.IsNotFound(err) && !srcRemote {
+		// the target directory does not exist yet
+		remoteFiles, err = map[string]syncEntry{}, nil
+	}
+	exitFailed("sync", cosPrefix+remote, err)
+	if srcRemote {
+		exitIfErr(os.MkdirAll(local, 0766))
+	}
+	localFiles, err := listLocal(local, f, *s.checksum)
+	exitFailed("sync", local, err)
+
+	if srcRemote {
+		s.apply(remote, local, remoteFiles, localFiles, func(name string, entry syncEntry) error {
+			target := filepath.Join(local, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(target), 0766); err != nil {
+				return err
+			}
+			if _, err := cosClient.DownloadContext(ctx, remote+name, target); err != nil {
+				return err
+			}
+			mtime := time.Unix(entry.mtime, 0)
+			return os.Chtimes(target, mtime, mtime)
+		}, func(name string) error {
+			return os.Remove(filepath.Join(local, filepath.FromSlash(name)))
+		})
+	} else {
+		s.apply(local, remote, localFiles, remoteFiles, func(name string, entry syncEntry) error {
+			return cosClient.UploadFileContext(ctx, filepath.Join(local, filepath.FromSlash(name)), remote+name, true)
+		}, func(name string) error {
+			return cosClient.DeleteResourceContext(ctx, remote+name, false, false, nil, nil)
+		})
+	}
+}
+
+// apply transfers the files of src missing or changed in dst, then deletes the files only in dst
+// when --delete is given. Names are relative to the synchronized directories srcDir and dstDir
+// and use "/".
+func (s *SyncCommand) apply(srcDir, dstDir string, src, dst map[string]syncEntry, transfer func(string, syncEntry) error, remove func(string) error) {
+	event := func(op, name string, start time.Time, err error) *Event {
+		e := newEvent(op, name, err).since(start)
+		switch {
+		case err != nil:
+			e.Text = fmt.Sprintf("[failre  %s] - %s\r\n", name, err)
+		case *s.dryRun:
+			e.Status = STATUS_DRY_RUN
+			e.Text = fmt.Sprintf("(dry-run) [%-7s %s]\r\n", op, name)
+		default:
+			e.Text = fmt.Sprintf("[%-7s %s]\r\n", op, name)
+		}
+		return e
+	}
+
+	for _, name := range sortedNames(src) {
+		entry := src[name]
+		existing, ok := dst[name]
+		if ok && !s.changed(entry, existing) {
+			continue
+		}
+		start := time.Now()
+		var err error
+		if !*s.dryRun {
+			err = transfer(name, entry)
+		}
+		e := event("copy", name, start, err)
+		e.Path = path.Join(srcDir, name)
+		e.Target = path.Join(dstDir, name)
+		e.Bytes = entry.size
+		report(e)
+	}
+
+	if !*s.delete {
+		return
+	}
+	for _, name := range sortedNames(dst) {
+		if _, ok := src[name]; ok {
+			continue
+		}
+		start := time.Now()
+		var err error
+		if !*s.dryRun {
+			err = remove(name)
+		}
+		e := event("delete", name, start, err)
+		e.Path = path.Join(dstDir, name)
+		report(e)
+	}
+}
+
+// changed reports whether src has to be copied over dst. With --checksum the sha decides when both
+// sides have one, otherwise a different size or a newer source does.
+func (s *SyncCommand) changed(src, dst syncEntry) bool {
+	if *s.checksum && src.sha != "" && dst.sha != "" {
+		return !strings.EqualFold(src.sha, dst.sha)
+	}
+	return src.size != dst.size || src.mtime > dst.mtime
+}
+
+func sortedNames(entries map[string]syncEntry) []string {
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func listLocal(root string, f *filter.Filter, checksum bool) (map[string]syncEntry, error) {
+	entries := map[string]syncEntry{}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if info.IsDir() {
+			if rel != "." && !f.Match(rel+"/") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !f.Match(rel) {
+			return nil
+		}
+		entry := syncEntry{size: info.Size(), mtime: info.ModTime().Unix()}
+		if checksum {
+			if entry.sha, err = cosclient.FileSha(path); err != nil {
+				return err
+			}
+		}
+		entries[rel] = entry
+		return nil
+	})
+	return entries, err
+}
+
+func listRemote(ctx context.Context, cosClient *cosclient.CosClient, f *filter.Filter, dir string) (map[string]syncEntry, error) {
+	entries := map[string]syncEntry{}
+	err := cosClient.WalkContext(ctx, dir, func(path string, resource cosclient.CosResource) error {
+		rel := path[len(dir):]
+		if !f.Match(rel) {
+			return cosclient.SkipDir
+		}
+		if !resource.IsDir() {
+			entries[rel] = syncEntry{resource.FileSize, resource.Mtime, resource.Sha}
+		}
+		return nil
+	})
+	return entries, err
+}
+
+func CreateSyncCommand(app *kingpin.Application) *SyncCommand {
+	clause := app.Command("sync", "one-way sync between a local directory and a cos: directory.")
+
+	return &SyncCommand{
+		clause:   clause,
+		src:      clause.Arg("src", "source directory, cos paths are prefixed with cos:").Required().String(),
+		dst:      clause.Arg("dst", "destination directory, cos paths are prefixed with cos:").Required().String(),
+		delete:   clause.Flag("delete", "delete files in dst that are not in src").Bool(),
+		dryRun:   clause.Flag("dry-run", "only print what would be done").Short('n').Bool(),
+		checksum: clause.Flag("checksum", "compare sha1 instead of size and mtime").Short('c').Bool(),
+		filter:   addFilterFlags(clause),
+	}
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"gocos/cosfake"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSync(t *testing.T) {
+	server := cosfake.New()
+	defer server.Close()
+	client := server.Client()
+
+	local := t.TempDir()
+	writeFile(t, filepath.Join(local, "a.txt"), []byte("a"))
+	writeFile(t, filepath.Join(local, "sub", "b.txt"), []byte("b"))
+
+	args := []string{"sync", local, "cos:/s/"}
+	_, code := run(t, client, args...)
+	expectCode(t, args, code, EXIT_OK)
+	expected := []string{"/s/", "/s/a.txt", "/s/sub/", "/s/sub/b.txt"}
+	if paths := server.Paths(); !reflect.DeepEqual(paths, expected) {
+		t.Errorf("sync up left %v, expected %v", paths, expected)
+	}
+
+	os.Remove(filepath.Join(local, "sub", "b.txt"))
+	writeFile(t, filepath.Join(local, "c.txt"), []byte("c"))
+
+	args = []string{"sync", "--delete", "-n", local, "cos:/s/"}
+	out, code := run(t, client, args...)
+	expectCode(t, args, code, EXIT_OK)
+	if !strings.Contains(out, "c.txt") || !strings.Contains(out, "sub/b.txt") || strings.Contains(out, "a.txt") {
+		t.Errorf("sync --dry-run printed %q", out)
+	}
+	if paths := server.Paths(); !reflect.DeepEqual(paths, expected) {
+		t.Errorf("sync --dry-run changed the bucket to %v", paths)
+	}
+
+	args = []string{"sync", "--delete", local, "cos:/s/"}
+	_, code = run(t, client, args...)
+	expectCode(t, args, code, EXIT_OK)
+	expected = []string{"/s/", "/s/a.txt", "/s/c.txt", "/s/sub/"}
+	if paths := server.Paths(); !reflect.DeepEqual(paths, expected) {
+		t.Errorf("sync --delete left %v, expected %v", paths, expected)
+	}
+
+	down := filepath.Join(t.TempDir(), "down")
+	args = []string{"sync", "cos:/s/", down}
+	_, code = run(t, client, args...)
+	expectCode(t, args, code, EXIT_OK)
+	for _, name := range []string{"a.txt", "c.txt"} {
+		if data, err := ioutil.ReadFile(filepath.Join(down, name)); err != nil || string(data) != name[:1] {
+			t.Errorf("sync down: %s is %q, %v", name, data, err)
+		}
+	}
+
+	args = []string{"sync", "--delete", "cos:/typo/", down}
+	_, code = run(t, client, args...)
+	expectCode(t, args, code, EXIT_NOT_FOUND)
+	if _, err := os.Stat(filepath.Join(down, "a.txt")); err != nil {
+		t.Errorf("sync --delete from a missing cos directory removed a.txt: %v", err)
+	}
+
+	args = []string{"sync", local, down}
+	_, code = run(t, client, args...)
+	expectCode(t, args, code, EXIT_USAGE)
+}
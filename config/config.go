@@ -0,0 +1,318 @@
+// Package config reads and edits the gocos config file, a set of named profiles
+// of cosclient.CosClient settings.
+//
+// The file is a JSON object
+//
+//	{
+//	  "current": "prod",
+//	  "profiles": {
+//	    "default": {"AppID": "1250000000", "SecretID": "...", "SecretKey": "..."},
+//	    "prod": {"Bucket": "prod-bucket"}
+//	  }
+//	}
+//
+// Every profile inherits the values it does not set from the default profile. A flat
+// object of CosClient fields, the format of earlier versions, is read as the default
+// profile.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gocos/cosclient"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const DEFAULT_PROFILE = "default"
+
+// ErrProfileNotFound is returned for a profile the file does not have.
+var ErrProfileNotFound = errors.New("profile not found")
+
+// Profile holds the values of a profile by key.
+type Profile map[string]json.RawMessage
+
+// File is a config file with its profiles.
+type File struct {
+	Path     string             `json:"-"`
+	Current  string             `json:"current,omitempty"`
+	Profiles map[string]Profile `json:"profiles"`
+}
+
+// Load reads the config file at path; a missing file is an empty one.
+func Load(path string) (*File, error) {
+	f := &File{Path: path, Profiles: map[string]Profile{}}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if _, ok := object["profiles"]; !ok {
+		// a flat config of earlier versions
+		f.Profiles[DEFAULT_PROFILE] = normalize(object)
+		return f, nil
+	}
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if f.Profiles == nil {
+		f.Profiles = map[string]Profile{}
+	}
+	for name, p := range f.Profiles {
+		f.Profiles[name] = normalize(p)
+	}
+	return f, nil
+}
+
+// Save writes the file, readable by the owner only as it holds secrets.
+func (f *File) Save() error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0700); err != nil {
+		return err
+	}
+	tmp := f.Path + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.Path)
+}
+
+// ProfileName returns name, or the current profile when name is empty.
+func (f *File) ProfileName(name string) string {
+	if name != "" {
+		return name
+	}
+	if f.Current != "" {
+		return f.Current
+	}
+	return DEFAULT_PROFILE
+}
+
+// Names returns the names of the profiles, sorted.
+func (f *File) Names() []string {
+	names := make([]string, 0, len(f.Profiles))
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Use makes name the current profile.
+func (f *File) Use(name string) error {
+	if _, ok := f.Profiles[name]; !ok && name != DEFAULT_PROFILE {
+		return fmt.Errorf("%w: %s", ErrProfileNotFound, name)
+	}
+	f.Current = name
+	return nil
+}
+
+// Get returns the value of key set by the profile itself, without inheritance.
+func (f *File) Get(profile, key string) (json.RawMessage, error) {
+	key, err := CanonicalKey(key)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := f.Profiles[profile][key]
+	if !ok {
+		return nil, fmt.Errorf("%s is not set in profile %s", key, profile)
+	}
+	return value, nil
+}
+
+// Set sets key of the profile, creating the profile if needed. The value is parsed as
+// JSON, a value that is not valid JSON is taken as a string.
+func (f *File) Set(profile, key, value string) error {
+	key, err := CanonicalKey(key)
+	if err != nil {
+		return err
+	}
+	raw, err := parseValue(key, value)
+	if err != nil {
+		return err
+	}
+	if f.Profiles[profile] == nil {
+		f.Profiles[profile] = Profile{}
+	}
+	f.Profiles[profile][key] = raw
+	return nil
+}
+
+// Unset removes key from the profile.
+func (f *File) Unset(profile, key string) error {
+	key, err := CanonicalKey(key)
+	if err != nil {
+		return err
+	}
+	delete(f.Profiles[profile], key)
+	return nil
+}
+
+// Apply configures client with the profile and the default profile it inherits from, and
+// records in sources which profile each value came from.
+func (f *File) Apply(profile string, client *cosclient.CosClient, sources map[string]string) error {
+	p, ok := f.Profiles[profile]
+	if !ok && profile != DEFAULT_PROFILE {
+		return fmt.Errorf("%w: %s in %s", ErrProfileNotFound, profile, f.Path)
+	}
+	merged := Profile{}
+	for key, value := range f.Profiles[DEFAULT_PROFILE] {
+		merged[key] = value
+		sources[key] = "profile " + DEFAULT_PROFILE
+	}
+	for key, value := range p {
+		merged[key] = value
+		sources[key] = "profile " + profile
+	}
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, client); err != nil {
+		return fmt.Errorf("profile %s: %w", profile, err)
+	}
+	return nil
+}
+
+// Override sets key of client to value, parsed like Set does, and records source as
+// where the value came from.
+func Override(client *cosclient.CosClient, key, value, source string, sources map[string]string) error {
+	key, err := CanonicalKey(key)
+	if err != nil {
+		return err
+	}
+	raw, err := parseValue(key, value)
+	if err != nil {
+		return fmt.Errorf("%s: %w", source, err)
+	}
+	if err := json.Unmarshal([]byte(`{"`+key+`":`+string(raw)+`}`), client); err != nil {
+		return fmt.Errorf("%s: %w", source, err)
+	}
+	sources[key] = source
+	return nil
+}
+
+// ApplyEnv overrides the values of client with the GOCOS_* environment variables named
+// by EnvVar. The credentials are left to EnvProvider, which only takes them in pairs.
+func ApplyEnv(client *cosclient.CosClient, sources map[string]string) error {
+	for _, key := range Keys() {
+		if key == "SecretID" || key == "SecretKey" || key == "SessionToken" {
+			continue
+		}
+		name := EnvVar(key)
+		if value, ok := os.LookupEnv(name); ok {
+			if err := Override(client, key, value, "env "+name, sources); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// EnvVar returns the environment variable of key, GOCOS_ and the key in upper snake case,
+// e.g. GOCOS_BUCKET or GOCOS_SECRET_ID.
+func EnvVar(key string) string {
+	var b strings.Builder
+	b.WriteString("GOCOS_")
+	runes := []rune(key)
+	for i, r := range runes {
+		upper := unicode.IsUpper(r)
+		if i > 0 && upper && (unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+// parseValue parses value as JSON when it is valid for key, and as a string otherwise.
+func parseValue(key, value string) (json.RawMessage, error) {
+	raw := json.RawMessage(value)
+	if !json.Valid(raw) {
+		raw, _ = json.Marshal(value)
+	}
+	// reject values the client could not be configured with
+	if err := json.Unmarshal([]byte(`{"`+key+`":`+string(raw)+`}`), &cosclient.CosClient{}); err != nil {
+		if fields()[key].Kind() != reflect.String {
+			return nil, fmt.Errorf("invalid value of %s: %w", key, err)
+		}
+		raw, _ = json.Marshal(value)
+	}
+	return raw, nil
+}
+
+// Keys returns the config keys, the JSON names of the CosClient fields.
+func Keys() []string {
+	keys := []string{}
+	t := reflect.TypeOf(cosclient.CosClient{})
+	for i := 0; i < t.NumField(); i++ {
+		if key := jsonName(t.Field(i)); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// CanonicalKey returns the config key matching key regardless of case.
+func CanonicalKey(key string) (string, error) {
+	for _, k := range Keys() {
+		if strings.EqualFold(k, key) {
+			return k, nil
+		}
+	}
+	return "", errors.New("unknown config key " + key + ", expected one of " + strings.Join(Keys(), ", "))
+}
+
+func fields() map[string]reflect.Type {
+	types := map[string]reflect.Type{}
+	t := reflect.TypeOf(cosclient.CosClient{})
+	for i := 0; i < t.NumField(); i++ {
+		if key := jsonName(t.Field(i)); key != "" {
+			types[key] = t.Field(i).Type
+		}
+	}
+	return types
+}
+
+func jsonName(field reflect.StructField) string {
+	if field.PkgPath != "" {
+		return ""
+	}
+	tag := strings.Split(field.Tag.Get("json"), ",")[0]
+	if tag == "-" {
+		return ""
+	}
+	if tag != "" {
+		return tag
+	}
+	return field.Name
+}
+
+// normalize renames the keys of a profile to their canonical case, as encoding/json
+// matches them case-insensitively.
+func normalize(p Profile) Profile {
+	normalized := Profile{}
+	for key, value := range p {
+		if k, err := CanonicalKey(key); err == nil {
+			key = k
+		}
+		normalized[key] = value
+	}
+	return normalized
+}
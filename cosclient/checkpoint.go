@@ -0,0 +1,134 @@
+package cosclient
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// checkpointSaveInterval bounds how often acknowledged slices are flushed to disk;
+// slices acknowledged after the last flush are recovered from upload_slice_list on resume.
+const checkpointSaveInterval = time.Second
+
+// uploadCheckpoint is the on-disk state of an unfinished slice upload; with an empty path
+// it is only kept in memory.
+type uploadCheckpoint struct {
+	Local     string  `json:"local"`
+	Remote    string  `json:"remote"`
+	FileSize  int64   `json:"filesize"`
+	Mtime     int64   `json:"mtime"`
+	Session   string  `json:"session"`
+	SliceSize int64   `json:"slice_size"`
+	Offsets   []int64 `json:"offsets"`
+
+	path  string
+	mu    sync.Mutex
+	saved time.Time
+}
+
+// checkpointPath returns the checkpoint file used for uploading local to remote.
+func (c *CosClient) checkpointPath(local, remote string) (string, error) {
+	dir := c.CheckpointDir
+	if dir == "" {
+		cache, err := os.UserCacheDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(cache, "gocos", "checkpoints")
+	}
+	sum := sha1.Sum([]byte(c.AppID + "/" + c.Bucket + remote + "\n" + local))
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+".json"), nil
+}
+
+// loadCheckpoint reads the checkpoint at path; it returns nil when there is none
+// or it does not describe the current state of the local file.
+func loadCheckpoint(path string, fi os.FileInfo, sliceSize int64) *uploadCheckpoint {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	cp := &uploadCheckpoint{}
+	if json.Unmarshal(data, cp) != nil {
+		return nil
+	}
+	if cp.FileSize != fi.Size() || cp.Mtime != fi.ModTime().UnixNano() || cp.SliceSize != sliceSize || cp.Session == "" {
+		return nil
+	}
+	cp.path = path
+	return cp
+}
+
+func newCheckpoint(path, local, remote string, fi os.FileInfo, sliceSize int64, session string) *uploadCheckpoint {
+	return &uploadCheckpoint{
+		Local:     local,
+		Remote:    remote,
+		FileSize:  fi.Size(),
+		Mtime:     fi.ModTime().UnixNano(),
+		Session:   session,
+		SliceSize: sliceSize,
+		path:      path,
+	}
+}
+
+// acked returns the set of offsets already stored by the service.
+func (cp *uploadCheckpoint) acked() map[int64]bool {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	done := make(map[int64]bool, len(cp.Offsets))
+	for _, offset := range cp.Offsets {
+		done[offset] = true
+	}
+	return done
+}
+
+// ack records an acknowledged slice, flushing to disk at most once per checkpointSaveInterval.
+func (cp *uploadCheckpoint) ack(offset int64) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.Offsets = append(cp.Offsets, offset)
+	if time.Since(cp.saved) >= checkpointSaveInterval {
+		cp.save()
+	}
+}
+
+// flush writes the checkpoint regardless of when it was last saved.
+func (cp *uploadCheckpoint) flush() error {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	return cp.save()
+}
+
+// save writes the checkpoint through a temp file so a crash never leaves it truncated.
+// The caller must hold mu.
+func (cp *uploadCheckpoint) save() error {
+	if cp.path == "" {
+		return nil
+	}
+	sort.Slice(cp.Offsets, func(i, j int) bool { return cp.Offsets[i] < cp.Offsets[j] })
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(cp.path), 0700); err != nil {
+		return err
+	}
+	tmp := cp.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	cp.saved = time.Now()
+	return os.Rename(tmp, cp.path)
+}
+
+func (cp *uploadCheckpoint) remove() {
+	if cp.path == "" {
+		return
+	}
+	os.Remove(cp.path)
+}
@@ -0,0 +1,190 @@
+package cosclient_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"gocos/cosclient"
+	"gocos/cosfake"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testSlice = 512 << 10
+
+// sliceServer is a fake recording the offsets of the slices it stores.
+type sliceServer struct {
+	*cosfake.Server
+	mu      sync.Mutex
+	offsets []int64
+	hook    func(offset int64) error
+}
+
+func newSliceServer() *sliceServer {
+	s := &sliceServer{Server: cosfake.New()}
+	s.SliceHook = func(path string, offset int64) error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.hook != nil {
+			if err := s.hook(offset); err != nil {
+				return err
+			}
+		}
+		s.offsets = append(s.offsets, offset)
+		return nil
+	}
+	return s
+}
+
+// stored returns the offsets stored since the last call.
+func (s *sliceServer) stored() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	offsets := s.offsets
+	s.offsets = nil
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	return offsets
+}
+
+func (s *sliceServer) client(checkpoints string) *cosclient.CosClient {
+	client := s.Client()
+	client.CheckpointDir = checkpoints
+	client.UploadThreshold = 1 << 20
+	client.UploadPartSize = testSlice
+	client.UploadConcurrency = 1
+	return client
+}
+
+// interrupt uploads local until the fake stored 3 slices and cancels the upload, returning
+// the offsets stored.
+func interrupt(t *testing.T, s *sliceServer, client *cosclient.CosClient, local string) []int64 {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	count := 0
+	s.hook = func(int64) error {
+		if count++; count == 3 {
+			cancel()
+		}
+		return nil
+	}
+	defer func() { s.hook = nil }()
+	if err := client.UploadFileContext(ctx, local, "/big.bin", true); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled upload: %v", err)
+	}
+	return s.stored()
+}
+
+func TestResumeUpload(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 10*testSlice/16)
+
+	for _, c := range []struct {
+		name  string
+		stale func(t *testing.T, s *sliceServer, local, checkpoints string)
+	}{
+		{"resumed", nil},
+		{"changed mtime", func(t *testing.T, s *sliceServer, local, checkpoints string) {
+			if err := os.Chtimes(local, time.Now(), time.Now().Add(-time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"changed size", func(t *testing.T, s *sliceServer, local, checkpoints string) {
+			if err := ioutil.WriteFile(local, append(data, 'x'), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"expired session", func(t *testing.T, s *sliceServer, local, checkpoints string) {
+			s.ExpireSessions()
+		}},
+		{"unknown session", func(t *testing.T, s *sliceServer, local, checkpoints string) {
+			names, _ := filepath.Glob(filepath.Join(checkpoints, "*.json"))
+			if len(names) != 1 {
+				t.Fatalf("checkpoints %v", names)
+			}
+			content, _ := ioutil.ReadFile(names[0])
+			var cp map[string]interface{}
+			json.Unmarshal(content, &cp)
+			cp["session"] = "unknown"
+			content, _ = json.Marshal(cp)
+			if err := ioutil.WriteFile(names[0], content, 0600); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	} {
+		s := newSliceServer()
+		checkpoints := t.TempDir()
+		client := s.client(checkpoints)
+		local := filepath.Join(t.TempDir(), "big.bin")
+		if err := ioutil.WriteFile(local, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		first := interrupt(t, s, client, local)
+		if len(first) < 3 {
+			t.Fatalf("%s: interrupted upload stored slices %v", c.name, first)
+		}
+		expected := data
+		if c.stale != nil {
+			c.stale(t, s, local, checkpoints)
+			expected, _ = ioutil.ReadFile(local)
+		}
+
+		if err := client.UploadFile(local, "/big.bin", true); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		second := s.stored()
+		if uploaded, _ := s.Get("/big.bin"); !bytes.Equal(uploaded, expected) {
+			t.Errorf("%s: uploaded %d bytes, expected %d", c.name, len(uploaded), len(expected))
+		}
+
+		slices := (len(expected) + testSlice - 1) / testSlice
+		if c.stale == nil {
+			// only the slices missing after the interruption are sent
+			sent := map[int64]bool{}
+			for _, offset := range append(first, second...) {
+				if sent[offset] {
+					t.Errorf("%s: slice at %d sent twice", c.name, offset)
+				}
+				sent[offset] = true
+			}
+			if len(sent) != slices {
+				t.Errorf("%s: slices %v then %v sent, expected %d in all", c.name, first, second, slices)
+			}
+		} else if len(second) != slices {
+			t.Errorf("%s: %d slices sent again, expected all %d", c.name, len(second), slices)
+		}
+		if names, _ := filepath.Glob(filepath.Join(checkpoints, "*.json")); len(names) != 0 {
+			t.Errorf("%s: checkpoints %v left after the upload", c.name, names)
+		}
+		s.Close()
+	}
+}
+
+func TestSliceFailureStopsUpload(t *testing.T) {
+	s := newSliceServer()
+	defer s.Close()
+	client := s.client(t.TempDir())
+	local := filepath.Join(t.TempDir(), "big.bin")
+	if err := ioutil.WriteFile(local, bytes.Repeat([]byte("x"), 10*testSlice), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	s.hook = func(int64) error {
+		if calls++; calls == 2 {
+			return errors.New("disk full")
+		}
+		return nil
+	}
+	if err := client.UploadFile(local, "/big.bin", true); err == nil {
+		t.Fatal("upload with a failing slice succeeded")
+	}
+	if calls != 2 {
+		t.Errorf("%d slices sent, expected the upload to stop after the failed second one", calls)
+	}
+}
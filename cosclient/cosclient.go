@@ -2,31 +2,36 @@ package cosclient
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"math/rand"
-	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
-	"text/template"
-	"time"
-
-	"crypto/hmac"
-	"crypto/sha1"
-	"encoding/base64"
 	"sync"
+	"time"
 )
 
 const (
-	MAX_SINGLE_SIZE int64 = 8 * 1024 * 1024
+	MAX_SINGLE_SIZE         int64 = 8 * 1024 * 1024
 	UPLOAD_SLICE_BLOCK_SIZE int64 = 1024 * 1024
 )
 
+var (
+	// ErrRemoteNotDir is returned when a local directory is uploaded to a remote path not ending with "/".
+	ErrRemoteNotDir = errors.New(`<remote> must end with "/"`)
+	// ErrIsDirectory is returned when a directory is deleted without recursive or moved.
+	ErrIsDirectory = errors.New("resource is a directory")
+	// ErrExists is returned when a file would be overwritten without cover.
+	ErrExists = errors.New("remote file already exists")
+)
+
 /**
  * CosClient
  */
@@ -34,11 +39,94 @@ type CosClient struct {
 	AppID     string
 	SecretID  string
 	SecretKey string
-	Bucket    string
-	Local     string
-	UseHttps  bool
+	// SessionToken is the token of temporary (STS) credentials.
+	SessionToken string `json:",omitempty"`
+	Bucket       string
+	Local        string
+	UseHttps     bool
+	// Endpoint replaces the public API domain, e.g. "https://cos.example.internal" or
+	// "127.0.0.1:8080" for a private cloud or a test server.
+	Endpoint string `json:",omitempty"`
+	// DownloadDomain replaces the domain of downloads and presigned URLs, e.g. a CDN domain
+	// bound to the bucket.
+	DownloadDomain string `json:",omitempty"`
+	// PathStyle addresses the bucket as the first path segment of the endpoint instead of
+	// as its subdomain.
+	PathStyle bool `json:",omitempty"`
+	// API selects the protocol: "json" (the default) for the legacy files/v2 API, "xml" for
+	// the XML API. Local may then be a short region like "gz" or a full one like "ap-guangzhou".
+	API string `json:",omitempty"`
+	// CredentialProcess is a command printing the credentials as JSON, used by
+	// ProcessProvider when no SecretID and SecretKey are configured.
+	CredentialProcess string `json:",omitempty"`
+	// CheckpointDir holds the checkpoints of unfinished slice uploads, defaults to
+	// the gocos/checkpoints directory under the user cache dir.
+	CheckpointDir string `json:",omitempty"`
+	// DownloadPartSize and DownloadConcurrency control how objects larger than one part
+	// are fetched as concurrent byte ranges; DownloadConcurrency 1 downloads with a single stream.
+	DownloadPartSize    int64 `json:",omitempty"`
+	DownloadConcurrency int   `json:",omitempty"`
+	// UploadThreshold is the size above which files are uploaded in slices of UploadPartSize,
+	// UploadConcurrency of them at once; they default to MAX_SINGLE_SIZE,
+	// UPLOAD_SLICE_BLOCK_SIZE and UPLOAD_CONCURRENCY and are checked against what the API takes.
+	UploadThreshold   int64 `json:",omitempty"`
+	UploadPartSize    int64 `json:",omitempty"`
+	UploadConcurrency int   `json:",omitempty"`
+	// FileConcurrency is how many files directory uploads and downloads move at once,
+	// FILE_CONCURRENCY by default.
+	FileConcurrency int `json:",omitempty"`
+	// LimitRate caps the bytes per second of all uploads and downloads together, 0 means no
+	// limit. The first window of RateSchedule covering the time of day overrides it.
+	LimitRate    int64        `json:",omitempty"`
+	RateSchedule []RateWindow `json:",omitempty"`
+	// Retry overrides DefaultRetryPolicy.
+	Retry *RetryPolicy `json:",omitempty"`
+	// OnRetry, if set, is called before a failed request or slice is tried again.
+	OnRetry func(what string, attempt int, err error) `json:"-"`
+	// OnProgress, if set, is called as files are uploaded and downloaded, concurrently for
+	// different files.
+	OnProgress func(Progress) `json:"-"`
+	// ConnectTimeout bounds dialing and the TLS handshake, ReadTimeout the wait for the
+	// response headers once a request is sent and then for each read of the response body,
+	// failing with ErrReadTimeout; 0 means no limit.
+	ConnectTimeout Duration `json:",omitempty"`
+	ReadTimeout    Duration `json:",omitempty"`
+	// Proxy is the URL of the proxy requests go through, HTTPS_PROXY or HTTP_PROXY when empty.
+	Proxy string `json:",omitempty"`
+	// CAFile is a PEM file of certificates trusted besides the system ones, e.g. the CA of a
+	// private cloud. TLSMinVersion is the lowest TLS version accepted, "1.0" to "1.3".
+	CAFile        string `json:",omitempty"`
+	TLSMinVersion string `json:",omitempty"`
+	// HTTPClient, if set, sends the requests and the timeouts, Proxy and TLS settings above
+	// are left to it. Otherwise Transport, or one made from those settings, is used.
+	HTTPClient *http.Client      `json:"-"`
+	Transport  http.RoundTripper `json:"-"`
+	// Middleware wraps the transport, the first one outermost.
+	Middleware []Middleware `json:"-"`
+	// Credentials, if set, supplies the credentials instead of SecretID, SecretKey and
+	// SessionToken; temporary ones are retrieved again shortly before they expire.
+	Credentials CredentialProvider `json:"-"`
+
+	// Signer signs the requests, one is created on first use when nil.
+	Signer *Signer `json:"-"`
+
+	credsMu    sync.Mutex
+	creds      *Credentials
+	signerOnce sync.Once
+	httpOnce   sync.Once
+	httpClient *http.Client
+	httpErr    error
+	rateOnce   sync.Once
+	rate       *rateLimiter
+	rateErr    error
 }
 
+// CODE_NOT_FOUND is the cos error code of a missing file or directory.
+const CODE_NOT_FOUND = -197
+
+// AUTH_ERROR_CODES are the cos error codes of rejected signatures and credentials.
+var AUTH_ERROR_CODES = []int{-62, -97}
+
 type CosError struct {
 	Code    int
 	Message string
@@ -48,513 +136,801 @@ func (e *CosError) Error() string {
 	return fmt.Sprintf("cos error - %d :%s", e.Code, e.Message)
 }
 
+// IsAuthError reports whether err means cos rejected the credentials or the signature.
+func IsAuthError(err error) bool {
+	var cosErr *CosError
+	if errors.As(err, &cosErr) {
+		for _, code := range AUTH_ERROR_CODES {
+			if code == cosErr.Code {
+				return true
+			}
+		}
+		return false
+	}
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && (statusErr.StatusCode == http.StatusUnauthorized || statusErr.StatusCode == http.StatusForbidden)
+}
+
+// IsNotFound reports whether err means the file or directory does not exist on cos.
+func IsNotFound(err error) bool {
+	var cosErr *CosError
+	if errors.As(err, &cosErr) {
+		return cosErr.Code == CODE_NOT_FOUND
+	}
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound
+}
+
+// StatusError is returned when the service answers with an unexpected HTTP status.
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return e.Status
+}
+
 type CosBaseResponse struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
 }
 
-var (
-	client = &http.Client{}
-)
+// Err returns a *CosError when the response carries a non-zero code.
+func (r *CosBaseResponse) Err() error {
+	if r.Code != 0 {
+		return &CosError{r.Code, r.Message}
+	}
+	return nil
+}
 
+// CosResource is an entry of a list response; directory names end with "/" and
+// carry no size or sha.
 type CosResource struct {
-	Name string `json:"name"`
+	Name      string `json:"name"`
+	BizAttr   string `json:"biz_attr,omitempty"`
+	FileSize  int64  `json:"filesize,omitempty"`
+	FileLen   int64  `json:"filelen,omitempty"`
+	Sha       string `json:"sha,omitempty"`
+	Ctime     int64  `json:"ctime,omitempty"`
+	Mtime     int64  `json:"mtime,omitempty"`
+	Authority string `json:"authority,omitempty"`
+	AccessUrl string `json:"access_url,omitempty"`
+	SourceUrl string `json:"source_url,omitempty"`
 }
 
-func (c *CosClient) Upload(local string, remote string, cover bool) {
+// IsDir reports whether the resource is a directory.
+func (r *CosResource) IsDir() bool {
+	return strings.HasSuffix(r.Name, "/")
+}
+
+// PathFilter selects the resources of recursive operations by their path relative to the
+// directory operated on, using "/" as separator and ending with "/" for directories.
+// A nil PathFilter selects everything.
+type PathFilter func(rel string) bool
+
+// UploadResult is the outcome of uploading one file.
+type UploadResult struct {
+	Local    string
+	Remote   string
+	Size     int64
+	Duration time.Duration
+	Err      error
+}
+
+// Upload uploads local to remote. When local is a directory every file below it selected by filter
+// is uploaded under remote, which must end with "/", FileConcurrency files at once. done, if not nil,
+// is called once per file with its outcome, concurrently for different files. The walk continues
+// past failed files and the first failure is returned.
+func (c *CosClient) Upload(local string, remote string, cover bool, filter PathFilter, done func(*UploadResult)) error {
+	return c.UploadContext(context.Background(), local, remote, cover, filter, done)
+}
+
+// UploadContext is like Upload; the walk stops once ctx is done.
+func (c *CosClient) UploadContext(ctx context.Context, local string, remote string, cover bool, filter PathFilter, done func(*UploadResult)) error {
 	fi, err := os.Stat(local)
-	panicError(err)
+	if err != nil {
+		return err
+	}
+	if done == nil {
+		done = func(*UploadResult) {}
+	}
+	upload := func(local, remote string, size int64) error {
+		start := time.Now()
+		err := c.UploadFileContext(ctx, local, remote, cover)
+		done(&UploadResult{local, remote, size, time.Since(start), err})
+		return err
+	}
 
-	if fi.IsDir() {
+	if !fi.IsDir() {
+		return upload(local, remote, fi.Size())
+	}
 
-		if !strings.HasSuffix(remote, "/") {
-			fmt.Fprintln(os.Stderr, `<remote> must end with "/"`)
-			os.Exit(-1)
+	if !strings.HasSuffix(remote, "/") {
+		return ErrRemoteNotDir
+	}
+	localAbs, err := filepath.Abs(local)
+	if err != nil {
+		return err
+	}
+	var (
+		mu    sync.Mutex
+		first error
+		wg    sync.WaitGroup
+	)
+	concurrency := c.EffectiveFileConcurrency()
+	threadPool := make(chan int, concurrency)
+	for i := 0; i < concurrency; i++ {
+		threadPool <- 1
+	}
+	err = filepath.Walk(localAbs, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
-		localAbs, _ := filepath.Abs(local)
-		filepath.Walk(localAbs, func(path string, info os.FileInfo, err error) error {
-			panicError(err)
-			if !info.IsDir() {
-				idx := len(localAbs)
-				c.UploadFile(path, remote + strings.Replace(path[idx:], string(os.PathSeparator), "/", -1), cover)
+		rel := strings.TrimPrefix(filepath.ToSlash(path[len(localAbs):]), "/")
+		if info.IsDir() {
+			if rel != "" && filter != nil && !filter(rel+"/") {
+				return filepath.SkipDir
 			}
 			return nil
-		})
-	} else {
-		c.UploadFile(local, remote, cover)
+		}
+		if filter == nil || filter(rel) {
+			select {
+			case <-threadPool:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			wg.Add(1)
+			go func(path, remote string, size int64) {
+				defer func() {
+					threadPool <- 1
+					wg.Done()
+				}()
+				if e := upload(path, remote, size); e != nil {
+					mu.Lock()
+					if first == nil {
+						first = e
+					}
+					mu.Unlock()
+				}
+			}(path, remote+rel, info.Size())
+		}
+		return nil
+	})
+	wg.Wait()
+	if err != nil {
+		return err
 	}
+	return first
+}
 
+// UploadFile uploads a single file, switching to the slice protocol for files larger than
+// UploadThreshold.
+func (c *CosClient) UploadFile(local string, remote string, cover bool) error {
+	return c.UploadFileContext(context.Background(), local, remote, cover)
 }
 
-func (c *CosClient) UploadFile(local string, remote string, cover bool) {
+func (c *CosClient) UploadFileContext(ctx context.Context, local string, remote string, cover bool) error {
 	fi, err := os.Stat(local)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	if fi.Size() > MAX_SINGLE_SIZE {
-		c.UploadLargeFile(local, remote, cover)
-		return
+	threshold, _, _, err := c.uploadParts()
+	if err != nil {
+		return err
+	}
+	if fi.Size() > threshold {
+		return c.UploadLargeFileContext(ctx, local, remote, cover)
 	}
 
-	file, err := os.Open(local)
-	defer file.Close()
+	fileContent, err := ioutil.ReadFile(local)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "[failre  %s] - %+v\r\n", remote, err)
+		return err
 	}
-	fileContent, _ := ioutil.ReadAll(file)
-	//shaSum := sha1.Sum(fileContent)
-
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-	writer.WriteField("op", "upload")
-	//writer.WriteField("sha", base64.StdEncoding.EncodeToString(shaSum[:]))
-	if cover {
-		writer.WriteField("insertOnly", "0")
+	p := c.progress(PROGRESS_UPLOAD, local, remote, int64(len(fileContent)))
+	err = c.uploadBytes(ctx, fileContent, remote, cover)
+	if err == nil {
+		p.add(int64(len(fileContent)))
 	}
-	writer.WriteField("filecontent", string(fileContent))
-
-	request, _ := http.NewRequest("POST", c.buildResourceURL(remote), body)
-	request.Header.Add("Authorization", c.multiSignature())
-	request.Header.Add("Content-Type", "multipart/form-data; boundary=" + writer.Boundary())
+	p.done(err)
+	return err
+}
 
-	result := CosBaseResponse{}
-	doRequestAsJson(request, &result)
-	if result.Code == 0 {
-		fmt.Printf("[ok   %s]\r\n", remote)
-	} else {
-		fmt.Fprintf(os.Stderr, "[failre  %s] - %d:%s\r\n", remote, result.Code, result.Message)
-	}
+// uploadBytes uploads fileContent with a single request.
+func (c *CosClient) uploadBytes(ctx context.Context, fileContent []byte, remote string, cover bool) error {
+	return c.protocol().putObject(ctx, fileContent, remote, cover)
 }
 
-func (c *CosClient) UploadLargeFile(local string, remote string, cover bool) {
+// UploadLargeFile uploads local with the upload_slice_* protocol, sending up to UploadConcurrency
+// slices concurrently.
+// The session and the acknowledged slices are kept in a checkpoint file so an interrupted
+// upload of the same unchanged file resumes where it stopped.
+func (c *CosClient) UploadLargeFile(local string, remote string, cover bool) error {
+	return c.UploadLargeFileContext(context.Background(), local, remote, cover)
+}
 
-	defer func() {
-		e := recover()
-		if e != nil {
-			fmt.Fprintf(os.Stderr, "[failure %s] - %+v\r\n", remote, e)
-		}
-	}()
+// UploadLargeFileContext is like UploadLargeFile; no further slices are sent once ctx is done
+// and the slices in flight are aborted.
+func (c *CosClient) UploadLargeFileContext(ctx context.Context, local string, remote string, cover bool) error {
 
 	file, err := os.Open(local)
+	if err != nil {
+		return err
+	}
 	defer file.Close()
+	fi, err := file.Stat()
 	if err != nil {
-		panic(err)
+		return err
 	}
-	fi, _ := file.Stat()
+	p := c.progress(PROGRESS_UPLOAD, local, remote, fi.Size())
+	err = c.uploadSlices(ctx, file, local, remote, cover, true, p)
+	p.done(err)
+	return err
+}
 
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-	writer.WriteField("op", "upload_slice_init")
-	writer.WriteField("filesize", strconv.FormatInt(fi.Size(), 10))
-	writer.WriteField("slice_size", strconv.FormatInt(UPLOAD_SLICE_BLOCK_SIZE, 10))
-	if cover {
-		writer.WriteField("insertOnly", "0")
+// uploadSlices uploads file with the upload_slice_* protocol. With checkpoint the progress is
+// kept in the checkpoint file of local so a later call can resume it. Acknowledged slices are
+// counted by p.
+func (c *CosClient) uploadSlices(ctx context.Context, file *os.File, local string, remote string, cover, checkpoint bool, p *progress) error {
+	fi, err := file.Stat()
+	if err != nil {
+		return err
 	}
 
-	url := c.buildResourceURL(remote)
-	sign := c.multiSignature()
-	request, _ := http.NewRequest("POST", url, body)
-	request.Header.Add("Authorization", sign)
-	request.Header.Add("Content-Type", "multipart/form-data; boundary=" + writer.Boundary())
+	_, sliceSize, concurrency, err := c.uploadParts()
+	if err != nil {
+		return err
+	}
+	if sliceSize, err = c.fitSlices(fi.Size(), sliceSize); err != nil {
+		return err
+	}
+	api := c.protocol()
 
-	var response struct {
-		Code    int    `json:"code"`
-		Message string `json:"Message"`
-		Data    struct {
-				Session string `json:"session"`
-			} `json:"data"`
+	var cp *uploadCheckpoint
+	if checkpoint {
+		cp, err = c.resumeSlices(ctx, local, remote, fi, sliceSize)
+		if err != nil {
+			return err
+		}
+	}
+	if cp == nil {
+		sha, parts, err := sliceShas(ctx, file, fi.Size(), sliceSize)
+		if err != nil {
+			return err
+		}
+		session, err := api.initSlices(ctx, remote, fi.Size(), sliceSize, sha, parts, cover)
+		if err != nil {
+			return err
+		}
+		path := ""
+		if checkpoint {
+			if path, err = c.checkpointPath(local, remote); err != nil {
+				return err
+			}
+		}
+		cp = newCheckpoint(path, local, remote, fi, sliceSize, session)
+		cp.flush()
 	}
-	doRequestAsJson(request, &response)
 
-	if response.Code != 0 {
-		fmt.Fprintf(os.Stderr, "[failure %s] - %s\r\n", remote, response.Message)
+	session := cp.Session
+	done := cp.acked()
+	for offset := range done {
+		p.add(sliceLength(offset, sliceSize, fi.Size()))
 	}
 
-	session := response.Data.Session
-	ch := make(chan int, fi.Size() / UPLOAD_SLICE_BLOCK_SIZE)
+	// the first failed slice stops the others, its error is the one returned
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		mu      sync.Mutex
+		first   error
+		waitter sync.WaitGroup
+	)
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if first == nil {
+			first = err
+			cancel()
+		}
+	}
 
 	var offset int64
-	count := 0
-
-	threadPool := make(chan int, 10)
-	for i := 0; i < 10; i++ {
+	threadPool := make(chan int, concurrency)
+	for i := 0; i < concurrency; i++ {
 		threadPool <- 1
 	}
 
-	for offset < fi.Size() {
+slices:
+	for ; offset < fi.Size(); offset += sliceSize {
+
+		if done[offset] {
+			continue
+		}
+
+		select {
+		case <-threadPool:
+		case <-ctx.Done():
+			break slices
+		}
 
-		b := make([]byte, UPLOAD_SLICE_BLOCK_SIZE)
-		length, _ := file.ReadAt(b, offset)
-		<-threadPool
-		go func(url, sign, session string, offset int64, bytes []byte, resultCH chan int) {
+		b := make([]byte, sliceSize)
+		length, err := file.ReadAt(b, offset)
+		if err != nil && err != io.EOF {
+			threadPool <- 1
+			fail(err)
+			break
+		}
+		waitter.Add(1)
+		go func(session string, offset int64, bytes []byte) {
 			defer func() {
 				threadPool <- 1
+				waitter.Done()
 			}()
-			uploadSlice(url, sign, session, offset, bytes, resultCH)
-		}(url, sign, session, offset, b[:length], ch)
-		offset = offset + int64(length)
-		count++
+			if err := api.uploadSlice(ctx, remote, session, sliceSize, offset, bytes); err != nil {
+				fail(err)
+				return
+			}
+			cp.ack(offset)
+			p.add(int64(len(bytes)))
+		}(session, offset, b[:length])
 	}
+	waitter.Wait()
 
-	var code int
-	succ := true
-	for i := 0; i < count; i++ {
+	if first == nil {
+		first = ctx.Err()
+	}
+	if first != nil {
+		cp.flush()
+		return first
+	}
 
-		code = <-ch
-		succ = succ && code == 0
+	if err := api.finishSlices(ctx, remote, session, fi.Size()); err != nil {
+		cp.flush()
+		return err
 	}
+	cp.remove()
+	return nil
+}
 
-	if succ {
+// sliceLength returns the length of the slice of sliceSize at offset of a file of the given size.
+func sliceLength(offset, sliceSize, size int64) int64 {
+	if offset+sliceSize > size {
+		return size - offset
+	}
+	return sliceSize
+}
 
-		body := &bytes.Buffer{}
-		writer := multipart.NewWriter(body)
-		writer.WriteField("op", "upload_slice_finish")
-		writer.WriteField("filesize", strconv.FormatInt(fi.Size(), 10))
-		writer.WriteField("session", session)
+// sliceList is the upload_slice_list view of an unfinished session.
+type sliceList struct {
+	FileSize  int64           `json:"filesize"`
+	Session   string          `json:"session"`
+	SliceSize int64           `json:"slice_size"`
+	ListParts []sliceListPart `json:"listparts"`
+}
 
-		request, _ = http.NewRequest("POST", url, body)
-		request.Header.Add("Authorization", sign)
-		request.Header.Add("Content-Type", "multipart/form-data; boundary=" + writer.Boundary())
+type sliceListPart struct {
+	Offset  int64 `json:"offset"`
+	DataLen int64 `json:"datalen"`
+}
 
-		response := CosBaseResponse{}
-		doRequestAsJson(request, &response)
-		if response.Code == 0 {
-			fmt.Printf("[ok     %s]\r\n", remote)
-		} else {
-			fmt.Fprintf(os.Stderr, "[fail %s] - %s\r\n", remote, response.Message)
+// resumeSlices returns the checkpoint of a previous upload of local to remote when the
+// service still holds its session, with the acknowledged offsets refreshed from the
+// service. It returns nil when the upload has to start over, also when it used another sliceSize.
+func (c *CosClient) resumeSlices(ctx context.Context, local, remote string, fi os.FileInfo, sliceSize int64) (*uploadCheckpoint, error) {
+	path, err := c.checkpointPath(local, remote)
+	if err != nil {
+		return nil, nil
+	}
+	cp := loadCheckpoint(path, fi, sliceSize)
+	if cp == nil {
+		return nil, nil
+	}
+	list, err := c.protocol().listSlices(ctx, remote, cp)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil || list.Session != cp.Session || list.FileSize != fi.Size() || list.SliceSize != cp.SliceSize {
+		cp.remove()
+		return nil, nil
+	}
+	cp.Offsets = cp.Offsets[:0]
+	for _, part := range list.ListParts {
+		if part.DataLen == cp.SliceSize || part.Offset+part.DataLen == fi.Size() {
+			cp.Offsets = append(cp.Offsets, part.Offset)
 		}
-
-	} else {
-		fmt.Fprintf(os.Stderr, "[failre %s]\r\n", remote)
 	}
-
+	cp.flush()
+	return cp, nil
 }
 
-func uploadSlice(url, sign, session string, offset int64, b []byte, ch chan int) {
-	body := &bytes.Buffer{}
-
-	writer := multipart.NewWriter(body)
-	writer.WriteField("op", "upload_slice_data")
-	writer.WriteField("session", session)
-	writer.WriteField("offset", strconv.FormatInt(offset, 10))
-	field, _ := writer.CreateFormField("filecontent")
-	field.Write(b)
+// DownloadStream passes the body of remote to callback and returns the callback's error.
+func (c *CosClient) DownloadStream(remote string, callback func(io.Reader) error) error {
+	return c.DownloadStreamContext(context.Background(), remote, callback)
+}
 
-	request, _ := http.NewRequest("POST", url, body)
-	request.Header.Add("Authorization", sign)
-	request.Header.Add("Content-Type", "multipart/form-data; boundary=" + writer.Boundary())
+func (c *CosClient) DownloadStreamContext(ctx context.Context, remote string, callback func(io.Reader) error) error {
+	return c.DownloadRangeContext(ctx, remote, "", callback)
+}
 
-	response := CosBaseResponse{}
-	doRequestAsJson(request, &response)
-	ch <- response.Code
+// DownloadRangeContext passes the bytes of remote selected by byteRange to callback. byteRange
+// is an HTTP byte range without the "bytes=" prefix, like "0-99", "100-" or "-100" for the
+// last 100 bytes; "" selects the whole object.
+func (c *CosClient) DownloadRangeContext(ctx context.Context, remote string, byteRange string, callback func(io.Reader) error) error {
+	request, err := http.NewRequestWithContext(ctx, "GET", c.protocol().downloadURL(remote), nil)
+	if err != nil {
+		return err
+	}
+	if err := c.authorize(request, ""); err != nil {
+		return err
+	}
+	if byteRange != "" {
+		request.Header.Add("Range", "bytes="+byteRange)
+	}
+	resp, err := c.doRequest(request)
+	if err != nil {
+		return fmt.Errorf("download %s: %w", remote, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 && resp.StatusCode != 206 || byteRange != "" && resp.StatusCode != 206 {
+		return fmt.Errorf("download %s: %w", remote, &StatusError{resp.StatusCode, resp.Status})
+	}
+	return callback(resp.Body)
+}
 
+// Download saves remote to the local file. Objects larger than DownloadPartSize are fetched as
+// concurrent byte ranges. A broken stream is retried as the retry policy allows, resuming with
+// a Range request from the bytes already written. The sha1 of the saved file is checked against
+// the one cos reports, a mismatching file is removed and ErrShaMismatch returned.
+// It returns the number of bytes written.
+func (c *CosClient) Download(remote string, local string) (int64, error) {
+	return c.DownloadContext(context.Background(), remote, local)
 }
 
-func (c *CosClient) UploadDirectory(local string, remote string, cover bool) {
+// DownloadContext is like Download. A partially written local file is removed when the
+// download fails or ctx is cancelled.
+func (c *CosClient) DownloadContext(ctx context.Context, remote string, local string) (int64, error) {
+	stat, err := c.StatFileContext(ctx, remote)
+	if err != nil {
+		return 0, err
+	}
 
+	p := c.progress(PROGRESS_DOWNLOAD, local, remote, stat.FileSize)
+	n, err := c.download(ctx, remote, local, stat, p)
+	p.done(err)
+	return n, err
 }
 
-func (c *CosClient) DownloadStream(remote string, callback func(io.Reader)) {
-	request, _ := http.NewRequest("GET", c.buildDownloadUrl(remote), nil)
-	request.Header.Add("Authorization", c.multiSignature())
-	resp, e := client.Do(request)
-	defer resp.Body.Close()
-	if e != nil {
-		fmt.Fprintf(os.Stderr, "error occurred while download %s : %+v", remote, e)
-		os.Exit(-1);
+func (c *CosClient) download(ctx context.Context, remote string, local string, stat *StatFileResult, p *progress) (n int64, err error) {
+	if partSize, concurrency := c.downloadParts(); concurrency > 1 && stat.FileSize > partSize {
+		n, err = c.downloadRanged(ctx, remote, local, stat.FileSize, p)
+	} else {
+		n, err = c.downloadSingle(ctx, remote, local, stat.FileSize, p)
+	}
+	if err != nil || stat.Sha == "" {
+		return n, err
+	}
+	if err := verifySha(local, stat.Sha); err != nil {
+		os.Remove(local)
+		return n, fmt.Errorf("download %s: %w", remote, err)
 	}
-	length, _ := strconv.ParseInt(resp.Header.Get("content-length"), 10, 32)
-	if length > 1024 * 1024 {
-		fmt.Fprintf(os.Stderr, "%s is too large , use `gocos pull` instead\n", remote);
-		os.Exit(-1);
-	};
-	callback(resp.Body);
+	return n, nil
 }
 
-func (c *CosClient) Download(remote string, local string, start int64, file *os.File) {
-
-	request, _ := http.NewRequest("GET", c.buildDownloadUrl(remote), nil)
-	request.Header.Add("Authorization", c.multiSignature())
-	if (start > 0 ) {
-		request.Header.Add("Range", "bytes=" + strconv.FormatInt(start, 10) + "-")
+// downloadSingle saves remote of the given size to local with one stream, the local file is
+// removed on failure. A broken stream is resumed with a Range request, or started over when
+// the server ignores the range.
+func (c *CosClient) downloadSingle(ctx context.Context, remote string, local string, size int64, p *progress) (n int64, err error) {
+	local, err = filepath.Abs(local)
+	if err != nil {
+		return 0, err
 	}
 
-	resp, _ := client.Do(request)
-	defer resp.Body.Close()
-	off := start
-	if resp.StatusCode == 200 || resp.StatusCode == 206 {
+	var file *os.File
+	defer func() {
+		if file == nil {
+			return
+		}
+		file.Close()
+		if err != nil {
+			os.Remove(local)
+		}
+	}()
+
+	var off int64
+	resumes := 0
+	for attempt := 1; ; attempt++ {
+		request, err := http.NewRequestWithContext(ctx, "GET", c.protocol().downloadURL(remote), nil)
+		if err != nil {
+			return off, err
+		}
+		if err := c.authorize(request, ""); err != nil {
+			return off, err
+		}
+		if off > 0 {
+			request.Header.Add("Range", "bytes="+strconv.FormatInt(off, 10)+"-")
+		}
+
+		resp, err := c.doRequest(request)
+		if err != nil {
+			return off, fmt.Errorf("download %s: %w", remote, err)
+		}
+		if resp.StatusCode != 200 && resp.StatusCode != 206 {
+			resp.Body.Close()
+			return off, fmt.Errorf("download %s: %w", remote, &StatusError{resp.StatusCode, resp.Status})
+		}
 
-		local, _ = filepath.Abs(local)
 		if file == nil {
-			var err error
-			file, err = os.Create(local)
+			f, err := os.Create(local)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "create %s failure: %s\r\n", local, err)
+				resp.Body.Close()
+				return off, err
+			}
+			file = f
+		}
+		if off > 0 && resp.StatusCode == 200 {
+			// the server ignored the range and sends the whole object again
+			if err := file.Truncate(0); err != nil {
+				resp.Body.Close()
+				return off, err
 			}
+			p.add(-off)
+			off = 0
 		}
-		defer file.Close()
 
-		for {
-			buf := make([]byte, 32 * 1024)
-			readLen, e := resp.Body.Read(buf)
+		start := off
+		off, err = copyAt(file, c.throttleReader(ctx, resp.Body), off, p)
+		resp.Body.Close()
+		if err == nil && off < size {
+			err = io.ErrUnexpectedEOF
+		}
+		if err == nil && off > size {
+			return off, fmt.Errorf("download %s: got %d bytes, expected %d", remote, off, size)
+		}
+		if err == nil {
+			return off, nil
+		}
+		if off > start && resumes < MAX_RESUMES {
+			// some bytes arrived before the stream broke, count from here
+			resumes++
+			attempt = 1
+		}
+		if !c.wait(ctx, remote, attempt, err) {
+			return off, err
+		}
+	}
+}
 
-			if (readLen > 0 ) {
-				length, we := file.WriteAt(buf[:readLen], off)
-				off += int64(length)
-				if we != nil {
-					fmt.Fprintf(os.Stderr, "write %s failure: %+v\r\n", local, we)
-					return
-				}
-			}
+type writeError struct {
+	err error
+}
 
-			if e != nil {
-				if e == io.EOF {
-					fmt.Printf("download %s to %s success!\r\n", remote, local)
-					return
-				} else {
-					if off == start {
-						fmt.Fprintf(os.Stderr, "download %s failure: %+v\r\n", remote, e)
-						return
-					} else {
-						fmt.Fprintf(os.Stderr, "%s download error (%+v), retry!\r\n", remote, e)
-						c.Download(remote, local, off, file)
-						return
-					}
+func (e *writeError) Error() string {
+	return e.err.Error()
+}
 
-				}
-			}
+func (e *writeError) Unwrap() error {
+	return e.err
+}
 
+// copyAt copies r into file starting at off and returns the offset reached; p counts the
+// bytes written.
+func copyAt(file *os.File, r io.Reader, off int64, p *progress) (int64, error) {
+	buf := make([]byte, 32*1024)
+	for {
+		readLen, e := r.Read(buf)
+		if readLen > 0 {
+			length, we := file.WriteAt(buf[:readLen], off)
+			off += int64(length)
+			p.add(int64(length))
+			if we != nil {
+				return off, &writeError{we}
+			}
+		}
+		if e == io.EOF {
+			return off, nil
+		}
+		if e != nil {
+			return off, e
 		}
-
-	} else {
-		fmt.Fprintf(os.Stderr, "download %s failure: %s \r\n", remote, resp.Status)
 	}
-
 }
 
-func (c *CosClient) UpdateAuthority(remote, authority *string) CosBaseResponse {
-	data := struct {
-		Op        string    `json:"op"`
-		Authority string `json:"authority"`
-	}{"update", *authority, }
-
-	body, _ := json.Marshal(data)
-	request, _ := http.NewRequest("POST", c.buildResourceURL(*remote), bytes.NewBuffer(body))
-	request.Header.Add("Authorization", c.multiSignature())
-	request.Header.Add("Content-Type", "application/json")
+func (c *CosClient) UpdateAuthority(remote, authority string) error {
+	return c.UpdateAuthorityContext(context.Background(), remote, authority)
+}
 
-	response := CosBaseResponse{}
-	doRequestAsJson(request, &response)
-	return response
+func (c *CosClient) UpdateAuthorityContext(ctx context.Context, remote, authority string) error {
+	return c.protocol().updateAuthority(ctx, remote, authority)
 }
 
 // ListResponse : cos list response
 type ListResponse struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
-	Data    struct {
-			Listover bool          `json:"listover"`
-			Context  string        `json:"context"`
-			Infos    []CosResource `json:"infos"`
-		} `json:"data"`
+	CosBaseResponse
+	Data struct {
+		Listover bool          `json:"listover"`
+		Context  string        `json:"context"`
+		Infos    []CosResource `json:"infos"`
+	} `json:"data"`
 }
 
 type StatFileResult struct {
-	AccessUrl     string `json:"access_url,omitempty"`
-	Authority     string `json:"authority,omitempty"`
-	BizAttr       string `json:"biz_attr"`
-	Ctime         int64 `json:"ctime"`
+	AccessUrl     string                 `json:"access_url,omitempty"`
+	Authority     string                 `json:"authority,omitempty"`
+	BizAttr       string                 `json:"biz_attr"`
+	Ctime         int64                  `json:"ctime"`
 	CustomHeaders map[string]interface{} `json:"custom_headers"`
-	FileLen       int64 `json:"filelen"`
-	FileSize      int64 `json:"filesize"`
-	Forbid        int `json:"forbid"`
-	Mtime         int64 `json:"mtime"`
-	PreviewUrl    string `json:"preview_url,omitempty"`
-	Sha           string `json:"sha,omitempty"`
-	SliceSize     int64 `json:"slicesize,omitempty"`
-	SourceUrl     string `json:"source_url,omitempty"`
+	FileLen       int64                  `json:"filelen"`
+	FileSize      int64                  `json:"filesize"`
+	Forbid        int                    `json:"forbid"`
+	Mtime         int64                  `json:"mtime"`
+	PreviewUrl    string                 `json:"preview_url,omitempty"`
+	Sha           string                 `json:"sha,omitempty"`
+	SliceSize     int64                  `json:"slicesize,omitempty"`
+	SourceUrl     string                 `json:"source_url,omitempty"`
 }
 
-func (c *CosClient) StatFile(path string) *map[string]interface{} {
-
-	request, _ := http.NewRequest("GET", c.buildResourceURL(path) + "?op=stat", nil)
-	request.Header.Add("Authorization", c.multiSignature())
-	response := &map[string]interface{}{}
-	doRequestAsJson(request, response)
-	//json.NewEncoder(os.Stdout).Encode(response)
-	return response
+func (c *CosClient) StatFile(path string) (*StatFileResult, error) {
+	return c.StatFileContext(context.Background(), path)
+}
 
+func (c *CosClient) StatFileContext(ctx context.Context, path string) (*StatFileResult, error) {
+	return c.protocol().stat(ctx, path)
 }
 
-func (c *CosClient) List(path string, context string) {
+// List returns every resource directly under path, following list contexts until the listing is over.
+func (c *CosClient) List(path string) ([]CosResource, error) {
+	return c.ListContext(context.Background(), path)
+}
 
-	response := c.ExecList(path, context)
+func (c *CosClient) ListContext(ctx context.Context, path string) ([]CosResource, error) {
 
-	for _, resource := range response.Data.Infos {
-		fmt.Println(resource.Name)
+	var resources []CosResource
+	listContext := ""
+	for {
+		response, err := c.ExecListContext(ctx, path, listContext)
+		if err != nil {
+			return resources, err
+		}
+		resources = append(resources, response.Data.Infos...)
+		if response.Data.Listover {
+			return resources, nil
+		}
+		listContext = response.Data.Context
 	}
+}
 
-	if !response.Data.Listover {
-		c.List(path, response.Data.Context)
-	}
+func (c *CosClient) ExecList(path string, listContext string) (*ListResponse, error) {
+	return c.ExecListContext(context.Background(), path, listContext)
 }
 
-func (c *CosClient) ExecList(path string, context string) *ListResponse {
+// ExecListContext requests one page of the listing of path; listContext is the context
+// returned by the previous page, or "" for the first one.
+func (c *CosClient) ExecListContext(ctx context.Context, path string, listContext string) (*ListResponse, error) {
+	return c.protocol().list(ctx, path, listContext)
+}
 
-	query := "?op=list&num=1000"
-	if context != "" {
-		query = query + "&context=" + context
-	}
-	request, _ := http.NewRequest("GET", c.buildResourceURL(path) + query, nil)
-	request.Header.Add("Authorization", c.multiSignature())
+// DeleteResource deletes path. Directories (paths ending with "/") need recursive, and with force
+// their children selected by filter are deleted first. done, if not nil, is called for every resource deleted or failed.
+// The first failure is returned.
+func (c *CosClient) DeleteResource(path string, recursive, force bool, filter PathFilter, done func(path string, err error)) error {
+	return c.DeleteResourceContext(context.Background(), path, recursive, force, filter, done)
+}
 
-	response := ListResponse{}
-	doRequestAsJson(request, &response)
+// DeleteResourceContext is like DeleteResource. With a filter only the selected children are
+// deleted and directories are kept.
+func (c *CosClient) DeleteResourceContext(ctx context.Context, path string, recursive, force bool, filter PathFilter, done func(path string, err error)) error {
 
-	if response.Code != 0 {
-		panic(CosError{response.Code, response.Message})
+	if strings.HasSuffix(path, "/") && !recursive {
+		return ErrIsDirectory
 	}
-
-	return &response
-
+	if done == nil {
+		done = func(string, error) {}
+	}
+	return c.deleteResource(ctx, path, "", force, filter, done)
 }
 
-func (c *CosClient) DeleteResource(path string, recursive, force bool) {
+func (c *CosClient) deleteResource(ctx context.Context, root, rel string, force bool, filter PathFilter, done func(path string, err error)) error {
 
-	if strings.HasSuffix(path, "/") && !recursive {
-		fmt.Fprintln(os.Stderr, "use -r for delete directories\r\n")
-		os.Exit(1)
-	}
+	path := root + rel
+	var first error
 
 	// 删除子目录文件
 
 	if force && strings.HasSuffix(path, "/") {
-		listOver := false
-		context := ""
-		for !listOver {
-			listResp := c.ExecList(path, context)
-			listOver = listResp.Data.Listover
-			context = listResp.Data.Context
-
-			for _, resource := range listResp.Data.Infos {
-				c.DeleteResource(path + resource.Name, recursive, force)
-
+		resources, err := c.ListContext(ctx, path)
+		if err != nil {
+			return err
+		}
+		for _, resource := range resources {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if filter != nil && !filter(rel+resource.Name) {
+				continue
+			}
+			if err := c.deleteResource(ctx, root, rel+resource.Name, force, filter, done); err != nil && first == nil {
+				first = err
 			}
-
 		}
-
+	}
+	if filter != nil && strings.HasSuffix(path, "/") {
+		return first
 	}
 
-	data := struct {
-		Op string `json:"op"`
-	}{"delete"}
-	body, _ := json.Marshal(data)
-
-	request, _ := http.NewRequest("POST", c.buildResourceURL(path), bytes.NewBuffer(body))
-	sign := c.onceSignature(path)
-	request.Header.Add("Authorization", sign)
-	request.Header.Add("Content-Type", "application/json")
-	//println(path
-	result := CosBaseResponse{}
-	doRequestAsJson(request, &result)
-	if result.Code == 0 {
-		fmt.Printf("[Deleted %s]\r\n", path)
-	} else {
-		fmt.Fprintf(os.Stderr, "Failure(%s), %s\r\n", result.Message, path)
+	err := c.protocol().delete(ctx, path)
+	done(path, err)
+	if first == nil {
+		first = err
 	}
+	return first
+}
+
+// Move moves the file src to target; directories can not be moved.
+func (c *CosClient) Move(src, target string, force bool) error {
+	return c.MoveContext(context.Background(), src, target, force)
 }
 
-func (c *CosClient) Move(src, target string, force bool) {
+func (c *CosClient) MoveContext(ctx context.Context, src, target string, force bool) error {
 
 	if strings.HasSuffix(src, "/") {
-		fmt.Fprintln(os.Stderr, "can not move directory !\r\n")
-		os.Exit(1)
+		return ErrIsDirectory
 	}
 
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-	writer.WriteField("op", "move")
-	writer.WriteField("dest_fileid", target)
-	if force {
-		writer.WriteField("to_over_write", "1")
+	return c.protocol().move(ctx, src, target, force)
+}
+
+// authorize signs request as the protocol requires, for the single file given or for any
+// request when file is "", and attaches the session token of temporary credentials.
+func (c *CosClient) authorize(request *http.Request, file string) error {
+	creds, err := c.credentials(request.Context())
+	if err != nil {
+		return err
 	}
+	c.protocol().authorize(request, creds, file)
+	if creds.SessionToken != "" {
+		request.Header.Set(SECURITY_TOKEN_HEADER, creds.SessionToken)
+	}
+	return nil
+}
 
-	request, _ := http.NewRequest("POST", c.buildResourceURL(src), body)
-	request.Header.Add("Authorization", c.onceSignature(src))
-	request.Header.Add("Content-Type", "multipart/form-data; boundary=" + writer.Boundary())
+// baseURL completes endpoint, a host or a URL, into a URL without trailing "/", with the
+// scheme of UseHttps when it has none.
+func (c *CosClient) baseURL(endpoint string) string {
+	if !strings.Contains(endpoint, "://") {
+		if c.UseHttps {
+			endpoint = "https://" + endpoint
+		} else {
+			endpoint = "http://" + endpoint
+		}
+	}
+	return strings.TrimRight(endpoint, "/")
+}
 
-	result := CosBaseResponse{}
-	doRequestAsJson(request, &result)
-	if result.Code == 0 {
-		fmt.Printf("[Move %s to %s Success]\r\n", src, target)
-	} else {
-		fmt.Printf("[Move %s to %s failure : %s]\r\n", src, target, result.Message)
-	}
-}
-
-func (c *CosClient) onceSignature(file string) string {
-
-	var data = struct {
-		AppID    string
-		SecretID string
-		Bucket   string
-		Exprire  int64
-		Now      int64
-		Random   int
-		File     string
-	}{c.AppID, c.SecretID, c.Bucket, 0, time.Now().Unix(), rand.Intn(9000000000) + 1000000000, "/" + c.AppID + "/" + c.Bucket + file}
-	t, _ := template.New("signature-once").Parse("a={{.AppID}}&b={{.Bucket}}&k={{.SecretID}}&e={{.Exprire}}&t={{.Now}}&r={{.Random}}&f={{.File}}")
-	var s bytes.Buffer
-	t.Execute(&s, data)
-
-	hash := hmac.New(sha1.New, []byte(c.SecretKey))
-	hash.Write([]byte(s.String()))
-	sum := hash.Sum(nil)
-	sign := base64.StdEncoding.EncodeToString(append(sum, []byte(s.String())...))
-	return sign
-
-}
-
-var signatureHolder = struct {
-	once      sync.Once
-	signature string
-}{sync.Once{}, ""}
-
-func (c *CosClient) multiSignature() string {
-	signatureHolder.once.Do(func() {
-		var data = struct {
-			AppID    string
-			SecretID string
-			Bucket   string
-			Exprire  int64
-			Now      int64
-			Random   int
-		}{c.AppID, c.SecretID, c.Bucket, time.Now().Unix() + 7776000, time.Now().Unix(), rand.Intn(9000000000) + 1000000000}
-		t, _ := template.New("signature-multi").Parse("a={{.AppID}}&b={{.Bucket}}&k={{.SecretID}}&e={{.Exprire}}&t={{.Now}}&r={{.Random}}&f=")
-		var s bytes.Buffer
-		t.Execute(&s, data)
-
-		hash := hmac.New(sha1.New, []byte(c.SecretKey))
-		hash.Write(s.Bytes())
-		sum := hash.Sum(nil)
-		sign := base64.StdEncoding.EncodeToString(append(sum, []byte(s.String())...))
-		signatureHolder.signature = sign
-	})
-	return signatureHolder.signature;
+// bucketURL returns the URL of the bucket on endpoint, a subdomain of it or with PathStyle
+// its first path segment.
+func (c *CosClient) bucketURL(endpoint string) string {
+	base := c.baseURL(endpoint)
+	name := c.Bucket + "-" + c.AppID
+	if c.PathStyle {
+		return base + "/" + name
+	}
+	i := strings.Index(base, "://") + len("://")
+	return base[:i] + name + "." + base[i:]
 }
 
 func (c *CosClient) buildResourceURL(path string) string {
 	var buffer bytes.Buffer
-	if c.UseHttps {
-		buffer.WriteString("https")
+	if c.Endpoint != "" {
+		buffer.WriteString(c.baseURL(c.Endpoint))
 	} else {
-		buffer.WriteString("http")
+		buffer.WriteString(c.baseURL(c.Local + ".file.myqcloud.com"))
 	}
-
-	buffer.WriteString("://")
-	buffer.WriteString(c.Local)
-	buffer.WriteString(".file.myqcloud.com/files/v2/")
+	buffer.WriteString("/files/v2/")
 	buffer.WriteString(string(c.AppID))
 	buffer.WriteString("/")
 	buffer.WriteString(c.Bucket)
@@ -568,48 +944,106 @@ func (c *CosClient) buildResourceURL(path string) string {
 func (c *CosClient) buildDownloadUrl(path string) string {
 
 	var buffer bytes.Buffer
-	if c.UseHttps {
-		buffer.WriteString("https")
-	} else {
-		buffer.WriteString("http")
+	switch {
+	case c.DownloadDomain != "":
+		buffer.WriteString(c.baseURL(c.DownloadDomain))
+	case c.Endpoint != "":
+		buffer.WriteString(c.bucketURL(c.Endpoint))
+	default:
+		buffer.WriteString(c.bucketURL("cos" + c.Local + ".myqcloud.com"))
 	}
-
-	buffer.WriteString("://")
-	buffer.WriteString(c.Bucket)
-	buffer.WriteString("-")
-	buffer.WriteString(c.AppID)
-	buffer.WriteString(".cos")
-	buffer.WriteString(c.Local)
-	buffer.WriteString(".myqcloud.com")
 	if !strings.HasPrefix(path, "/") {
-		buffer.WriteString("/")
+		path = "/" + path
 	}
-	buffer.WriteString(path)
+	// names may hold #, ? or %, which are not part of a path unescaped
+	buffer.WriteString((&url.URL{Path: path}).EscapedPath())
 	return buffer.String()
 
 }
 
-func doRequest(request *(http.Request)) *(http.Response) {
+// send makes a single try of request; 429 and 5xx responses are turned into a *StatusError.
+// The request body is sent no faster than LimitRate and RateSchedule allow.
+func (c *CosClient) send(request *http.Request) (*http.Response, error) {
+	client, err := c.client()
+	if err != nil {
+		return nil, err
+	}
+	if request, err = c.throttleRequest(request); err != nil {
+		return nil, err
+	}
 	resp, err := client.Do(request)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		resp.Body.Close()
+		return nil, &StatusError{resp.StatusCode, resp.Status}
+	}
+	return resp, nil
+}
+
+// rewind returns a copy of request with a fresh body so it can be sent again.
+func rewind(request *http.Request) (*http.Request, error) {
+	retry := request.Clone(request.Context())
+	if request.Body != nil && request.Body != http.NoBody {
+		if request.GetBody == nil {
+			return nil, errors.New("request body can not be replayed")
+		}
+		body, err := request.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		retry.Body = body
 	}
-	return resp
+	return retry, nil
 }
 
-func doRequestAsJson(request *http.Request, val interface{}) error {
-	resp := doRequest(request)
+// doRequest sends request, retrying as the client's retry policy allows.
+func (c *CosClient) doRequest(request *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := c.send(request)
+		if err == nil || !c.wait(request.Context(), request.URL.Path, attempt, err) {
+			return resp, err
+		}
+		if request, err = rewind(request); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// doRequestAsJson decodes the response of request into val and returns a *CosError
+// when the response carries a non-zero code. Retryable failures are tried again.
+func (c *CosClient) doRequestAsJson(request *http.Request, val interface{}) error {
+	for attempt := 1; ; attempt++ {
+		err := c.decodeResponse(request, val)
+		if err == nil || !c.wait(request.Context(), request.URL.Path, attempt, err) {
+			return err
+		}
+		if request, err = rewind(request); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *CosClient) decodeResponse(request *http.Request, val interface{}) error {
+	resp, err := c.send(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return err
 	}
 	decoder := json.NewDecoder(bytes.NewReader(body))
 	decoder.UseNumber()
-	return decoder.Decode(val)
-}
-
-func panicError(err error) {
-	if err != nil {
-		panic(err)
+	if err := decoder.Decode(val); err != nil {
+		if resp.StatusCode >= 300 {
+			return &StatusError{resp.StatusCode, resp.Status}
+		}
+		return err
 	}
+	base := CosBaseResponse{}
+	json.Unmarshal(body, &base)
+	return base.Err()
 }
@@ -0,0 +1,152 @@
+package cosclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// ErrNoCredentials is returned by a CredentialProvider that has no credentials to offer.
+var ErrNoCredentials = errors.New("no credentials")
+
+// SECURITY_TOKEN_HEADER carries the session token of temporary credentials.
+const SECURITY_TOKEN_HEADER = "x-cos-security-token"
+
+// CREDENTIAL_REFRESH_WINDOW is how long before they expire temporary credentials are
+// retrieved again, so requests of a long transfer never go out with expired keys.
+const CREDENTIAL_REFRESH_WINDOW = 5 * time.Minute
+
+// Credentials are the keys requests are signed with.
+type Credentials struct {
+	SecretID  string
+	SecretKey string
+	// SessionToken and Expiration are set for temporary (STS) credentials.
+	SessionToken string
+	Expiration   time.Time
+	// Source names where the credentials came from, e.g. "env" or "credential_process".
+	Source string `json:"-"`
+}
+
+func (c *Credentials) valid() bool {
+	return c != nil && c.SecretID != "" && c.SecretKey != ""
+}
+
+// CredentialProvider supplies the credentials of a client.
+type CredentialProvider interface {
+	// Retrieve returns the credentials, or ErrNoCredentials if the provider has none.
+	Retrieve(ctx context.Context) (*Credentials, error)
+}
+
+// StaticProvider provides fixed credentials, when both keys are set.
+type StaticProvider struct {
+	Credentials
+}
+
+func (p *StaticProvider) Retrieve(ctx context.Context) (*Credentials, error) {
+	if !p.Credentials.valid() {
+		return nil, ErrNoCredentials
+	}
+	creds := p.Credentials
+	return &creds, nil
+}
+
+const (
+	ENV_SECRET_ID     = "GOCOS_SECRET_ID"
+	ENV_SECRET_KEY    = "GOCOS_SECRET_KEY"
+	ENV_SESSION_TOKEN = "GOCOS_SESSION_TOKEN"
+)
+
+// EnvProvider provides the credentials of the GOCOS_SECRET_ID and GOCOS_SECRET_KEY
+// environment variables, with the session token of GOCOS_SESSION_TOKEN.
+type EnvProvider struct{}
+
+func (p EnvProvider) Retrieve(ctx context.Context) (*Credentials, error) {
+	creds := &Credentials{
+		SecretID:     os.Getenv(ENV_SECRET_ID),
+		SecretKey:    os.Getenv(ENV_SECRET_KEY),
+		SessionToken: os.Getenv(ENV_SESSION_TOKEN),
+		Source:       "env " + ENV_SECRET_ID + "/" + ENV_SECRET_KEY,
+	}
+	if !creds.valid() {
+		return nil, ErrNoCredentials
+	}
+	return creds, nil
+}
+
+// ProcessProvider runs Command with the shell and reads the credentials from the JSON
+// object it prints, e.g. {"SecretID": "...", "SecretKey": "..."}. Temporary credentials
+// add "SessionToken" and an RFC 3339 "Expiration", the command is run again before they
+// expire. Its stderr is passed through so the command can prompt or explain failures.
+type ProcessProvider struct {
+	Command string
+}
+
+func (p *ProcessProvider) Retrieve(ctx context.Context) (*Credentials, error) {
+	if strings.TrimSpace(p.Command) == "" {
+		return nil, ErrNoCredentials
+	}
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", p.Command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", p.Command)
+	}
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("credential_process: %w", err)
+	}
+	creds := &Credentials{}
+	if err := json.Unmarshal(stdout.Bytes(), creds); err != nil {
+		return nil, fmt.Errorf("credential_process: invalid output: %w", err)
+	}
+	if !creds.valid() {
+		return nil, errors.New("credential_process: output lacks SecretID or SecretKey")
+	}
+	creds.Source = "credential_process"
+	return creds, nil
+}
+
+// ChainProvider provides the credentials of the first of its providers that has some.
+type ChainProvider []CredentialProvider
+
+func (p ChainProvider) Retrieve(ctx context.Context) (*Credentials, error) {
+	for _, provider := range p {
+		creds, err := provider.Retrieve(ctx)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return creds, err
+	}
+	return nil, ErrNoCredentials
+}
+
+// CurrentCredentials returns the credentials requests are signed with, retrieving them from
+// Credentials when it is set and the ones retrieved before are about to expire.
+func (c *CosClient) CurrentCredentials(ctx context.Context) (*Credentials, error) {
+	return c.credentials(ctx)
+}
+
+func (c *CosClient) credentials(ctx context.Context) (*Credentials, error) {
+	if c.Credentials == nil {
+		return &Credentials{SecretID: c.SecretID, SecretKey: c.SecretKey, SessionToken: c.SessionToken}, nil
+	}
+	c.credsMu.Lock()
+	defer c.credsMu.Unlock()
+	if c.creds == nil || !c.creds.Expiration.IsZero() && time.Until(c.creds.Expiration) < CREDENTIAL_REFRESH_WINDOW {
+		creds, err := c.Credentials.Retrieve(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("retrieve credentials: %w", err)
+		}
+		c.creds = creds
+	}
+	return c.creds, nil
+}
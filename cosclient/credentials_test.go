@@ -0,0 +1,117 @@
+package cosclient_test
+
+import (
+	"context"
+	"errors"
+	"gocos/cosclient"
+	"gocos/cosfake"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChainProvider(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("credential_process commands are sh scripts")
+	}
+	process := &cosclient.ProcessProvider{Command: `echo '{"SecretID": "process-id", "SecretKey": "process-key"}'`}
+	for _, c := range []struct {
+		name          string
+		envID, envKey string
+		profile       cosclient.Credentials
+		process       string
+		expected      string
+	}{
+		{"env first", "env-id", "env-key", cosclient.Credentials{SecretID: "profile-id", SecretKey: "profile-key"}, process.Command, "env-id"},
+		{"env without a key", "env-id", "", cosclient.Credentials{SecretID: "profile-id", SecretKey: "profile-key"}, process.Command, "profile-id"},
+		{"profile before the process", "", "", cosclient.Credentials{SecretID: "profile-id", SecretKey: "profile-key"}, process.Command, "profile-id"},
+		{"process last", "", "", cosclient.Credentials{SecretID: "profile-id"}, process.Command, "process-id"},
+		{"none", "", "", cosclient.Credentials{}, "", ""},
+	} {
+		t.Setenv(cosclient.ENV_SECRET_ID, c.envID)
+		t.Setenv(cosclient.ENV_SECRET_KEY, c.envKey)
+		chain := cosclient.ChainProvider{
+			cosclient.EnvProvider{},
+			&cosclient.StaticProvider{Credentials: c.profile},
+			&cosclient.ProcessProvider{Command: c.process},
+		}
+		creds, err := chain.Retrieve(context.Background())
+		if c.expected == "" {
+			if !errors.Is(err, cosclient.ErrNoCredentials) {
+				t.Errorf("%s: retrieved %+v, %v, expected ErrNoCredentials", c.name, creds, err)
+			}
+			continue
+		}
+		if err != nil || creds.SecretID != c.expected {
+			t.Errorf("%s: retrieved %+v, %v, expected %s", c.name, creds, err, c.expected)
+		}
+	}
+}
+
+func TestProcessProvider(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("credential_process commands are sh scripts")
+	}
+	creds, err := (&cosclient.ProcessProvider{
+		Command: `echo '{"SecretID": "id", "SecretKey": "key", "SessionToken": "token", "Expiration": "2030-01-02T03:04:05Z"}'`,
+	}).Retrieve(context.Background())
+	expected := cosclient.Credentials{SecretID: "id", SecretKey: "key", SessionToken: "token",
+		Expiration: time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC), Source: "credential_process"}
+	if err != nil || *creds != expected {
+		t.Errorf("retrieved %+v, %v, expected %+v", creds, err, expected)
+	}
+
+	for _, c := range []struct {
+		command, expected string
+	}{
+		{"exit 3", "exit status 3"},
+		{"echo not json", "invalid output"},
+		{`echo '{"SecretID": "id"}'`, "lacks SecretID or SecretKey"},
+		{`echo '{"SecretID": "id", "SecretKey": "key", "Expiration": "tomorrow"}'`, "invalid output"},
+	} {
+		creds, err := (&cosclient.ProcessProvider{Command: c.command}).Retrieve(context.Background())
+		if err == nil || errors.Is(err, cosclient.ErrNoCredentials) || !strings.Contains(err.Error(), c.expected) {
+			t.Errorf("credential_process %q: retrieved %+v, %v, expected an error with %q", c.command, creds, err, c.expected)
+		}
+	}
+}
+
+// countingProvider provides the credentials of a fake, expiring after lifetime, and counts
+// how often they are retrieved.
+type countingProvider struct {
+	server    *cosfake.Server
+	lifetime  time.Duration
+	retrieved int
+}
+
+func (p *countingProvider) Retrieve(ctx context.Context) (*cosclient.Credentials, error) {
+	p.retrieved++
+	return &cosclient.Credentials{SecretID: p.server.SecretID, SecretKey: p.server.SecretKey,
+		SessionToken: "token", Expiration: time.Now().Add(p.lifetime)}, nil
+}
+
+func TestCredentialsRefresh(t *testing.T) {
+	server := cosfake.New()
+	defer server.Close()
+
+	for _, c := range []struct {
+		lifetime  time.Duration
+		retrieved int
+	}{
+		{time.Hour, 1},
+		{cosclient.CREDENTIAL_REFRESH_WINDOW - time.Minute, 3},
+	} {
+		provider := &countingProvider{server: server, lifetime: c.lifetime}
+		client := server.Client()
+		client.Credentials = provider
+		for i := 0; i < 3; i++ {
+			if _, err := client.List("/"); err != nil {
+				t.Fatalf("expiring in %s: %v", c.lifetime, err)
+			}
+		}
+		if provider.retrieved != c.retrieved {
+			t.Errorf("credentials expiring in %s retrieved %d times for 3 requests, expected %d", c.lifetime, provider.retrieved, c.retrieved)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package cosclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+const (
+	DOWNLOAD_PART_SIZE   int64 = 8 * 1024 * 1024
+	DOWNLOAD_CONCURRENCY       = 4
+)
+
+// MAX_RESUMES caps how often a download stream that made progress before breaking gets a
+// fresh set of retries, so a stream that keeps stalling fails in the end.
+const MAX_RESUMES = 10
+
+func (c *CosClient) downloadParts() (int64, int) {
+	partSize, concurrency := c.DownloadPartSize, c.DownloadConcurrency
+	if partSize <= 0 {
+		partSize = DOWNLOAD_PART_SIZE
+	}
+	if concurrency <= 0 {
+		concurrency = DOWNLOAD_CONCURRENCY
+	}
+	return partSize, concurrency
+}
+
+// downloadRanged saves remote of the given size to local by fetching its parts concurrently
+// into a preallocated file. The local file is removed when any part fails.
+func (c *CosClient) downloadRanged(ctx context.Context, remote, local string, size int64, p *progress) (n int64, err error) {
+	partSize, concurrency := c.downloadParts()
+
+	local, err = filepath.Abs(local)
+	if err != nil {
+		return 0, err
+	}
+	file, err := os.Create(local)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		file.Close()
+		if err != nil {
+			os.Remove(local)
+		}
+	}()
+	if err := file.Truncate(size); err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		first   error
+		waitter sync.WaitGroup
+	)
+	threadPool := make(chan int, concurrency)
+	for i := 0; i < concurrency; i++ {
+		threadPool <- 1
+	}
+
+parts:
+	for off := int64(0); off < size; off += partSize {
+		select {
+		case <-threadPool:
+		case <-ctx.Done():
+			break parts
+		}
+		end := off + partSize
+		if end > size {
+			end = size
+		}
+		waitter.Add(1)
+		go func(off, end int64) {
+			defer func() {
+				threadPool <- 1
+				waitter.Done()
+			}()
+			if err := c.downloadRange(ctx, remote, file, off, end, p); err != nil {
+				mu.Lock()
+				if first == nil {
+					first = err
+					cancel()
+				}
+				mu.Unlock()
+			}
+		}(off, end)
+	}
+	waitter.Wait()
+
+	if first != nil {
+		return 0, first
+	}
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+	return size, nil
+}
+
+// downloadRange writes bytes [off, end) of remote into file at the same offsets, resuming a
+// broken stream from the bytes already written as the retry policy allows.
+func (c *CosClient) downloadRange(ctx context.Context, remote string, file *os.File, off, end int64, p *progress) error {
+	resumes := 0
+	for attempt := 1; ; attempt++ {
+		request, err := http.NewRequestWithContext(ctx, "GET", c.protocol().downloadURL(remote), nil)
+		if err != nil {
+			return err
+		}
+		if err := c.authorize(request, ""); err != nil {
+			return err
+		}
+		request.Header.Add("Range", "bytes="+strconv.FormatInt(off, 10)+"-"+strconv.FormatInt(end-1, 10))
+
+		resp, err := c.doRequest(request)
+		if err != nil {
+			return fmt.Errorf("download %s: %w", remote, err)
+		}
+		if resp.StatusCode != 206 {
+			resp.Body.Close()
+			return fmt.Errorf("download %s: %w", remote, &StatusError{resp.StatusCode, resp.Status})
+		}
+
+		start := off
+		off, err = copyAt(file, c.throttleReader(ctx, io.LimitReader(resp.Body, end-off)), off, p)
+		resp.Body.Close()
+		if err == nil && off < end {
+			err = io.ErrUnexpectedEOF
+		}
+		if err == nil {
+			return nil
+		}
+		if off > start && resumes < MAX_RESUMES {
+			resumes++
+			attempt = 1
+		}
+		if !c.wait(ctx, remote, attempt, err) {
+			return err
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package cosclient_test
+
+import (
+	"bytes"
+	"errors"
+	"gocos/cosclient"
+	"gocos/cosfake"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// brokenDownloads serves data on a download domain through serve, which returns the bytes
+// to send before the connection is dropped or -1 to send the rest; ranges are honored
+// unless ignoreRange.
+func brokenDownloads(t *testing.T, data []byte, ignoreRange bool, serve func(request int) int) (string, func() int) {
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		n := serve(requests)
+		mu.Unlock()
+
+		body := data
+		if byteRange := strings.TrimPrefix(r.Header.Get("Range"), "bytes="); byteRange != r.Header.Get("Range") && !ignoreRange {
+			off, _ := strconv.Atoi(strings.TrimSuffix(byteRange, "-"))
+			body = data[off:]
+			w.Header().Set("Content-Range", "bytes "+byteRange+strconv.Itoa(len(data)-1)+"/"+strconv.Itoa(len(data)))
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+			w.WriteHeader(http.StatusPartialContent)
+		} else {
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		}
+		if n < 0 || n > len(body) {
+			w.Write(body)
+			return
+		}
+		w.Write(body[:n])
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+}
+
+func TestDownloadResume(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 100000)
+	server := cosfake.New()
+	defer server.Close()
+	server.Put("/big.bin", data)
+
+	for _, ignoreRange := range []bool{false, true} {
+		domain, _ := brokenDownloads(t, data, ignoreRange, func(request int) int {
+			if request == 1 {
+				return 300000
+			}
+			return -1
+		})
+		client := server.Client()
+		client.DownloadDomain = domain
+		client.Retry = &cosclient.RetryPolicy{MaxAttempts: 2, InitialBackoff: cosclient.Duration(time.Millisecond)}
+		local := filepath.Join(t.TempDir(), "big.bin")
+		n, err := client.Download("/big.bin", local)
+		if err != nil {
+			t.Fatalf("ignoring ranges %v: %v", ignoreRange, err)
+		}
+		if saved, _ := ioutil.ReadFile(local); n != int64(len(data)) || !bytes.Equal(saved, data) {
+			t.Errorf("ignoring ranges %v: downloaded %d bytes, saved %d", ignoreRange, n, len(saved))
+		}
+	}
+}
+
+func TestDownloadStalling(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 1000)
+	server := cosfake.New()
+	defer server.Close()
+	server.Put("/a.bin", data)
+	domain, requests := brokenDownloads(t, data, false, func(int) int { return 1 })
+
+	client := server.Client()
+	client.DownloadDomain = domain
+	client.Retry = &cosclient.RetryPolicy{MaxAttempts: 2, InitialBackoff: cosclient.Duration(time.Millisecond)}
+	if _, err := client.Download("/a.bin", filepath.Join(t.TempDir(), "a.bin")); err == nil {
+		t.Error("download of a stream sending one byte at a time succeeded")
+	}
+	if n := requests(); n > (cosclient.MAX_RESUMES+1)*2 {
+		t.Errorf("stalling stream requested %d times", n)
+	}
+}
+
+func TestDownloadShaMismatch(t *testing.T) {
+	server := cosfake.New()
+	defer server.Close()
+	server.Put("/a.txt", []byte("stored"))
+	domain, _ := brokenDownloads(t, []byte("served"), false, func(int) int { return -1 })
+
+	client := server.Client()
+	client.DownloadDomain = domain
+	local := filepath.Join(t.TempDir(), "a.txt")
+	if _, err := client.Download("/a.txt", local); !errors.Is(err, cosclient.ErrShaMismatch) {
+		t.Errorf("download of other bytes than stored: %v", err)
+	}
+	if _, err := os.Stat(local); !os.IsNotExist(err) {
+		t.Errorf("mismatching download left %s: %v", local, err)
+	}
+}
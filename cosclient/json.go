@@ -0,0 +1,282 @@
+package cosclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// jsonAPI is the legacy JSON API under <region>.file.myqcloud.com/files/v2/, signed with
+// multi-use and single-file signatures.
+type jsonAPI struct {
+	c *CosClient
+}
+
+func (a *jsonAPI) authorize(request *http.Request, creds *Credentials, file string) {
+	if file == "" {
+		request.Header.Set("Authorization", a.c.signer().Multi(a.c.AppID, a.c.Bucket, creds))
+	} else {
+		request.Header.Set("Authorization", a.c.signer().Once(a.c.AppID, a.c.Bucket, file, creds))
+	}
+}
+
+func (a *jsonAPI) list(ctx context.Context, path string, listContext string) (*ListResponse, error) {
+
+	query := "?op=list&num=1000"
+	if listContext != "" {
+		query = query + "&context=" + listContext
+	}
+	request, err := http.NewRequestWithContext(ctx, "GET", a.c.buildResourceURL(path)+query, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.c.authorize(request, ""); err != nil {
+		return nil, err
+	}
+
+	response := ListResponse{}
+	if err := a.c.doRequestAsJson(request, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+
+}
+
+func (a *jsonAPI) stat(ctx context.Context, path string) (*StatFileResult, error) {
+
+	request, err := http.NewRequestWithContext(ctx, "GET", a.c.buildResourceURL(path)+"?op=stat", nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.c.authorize(request, ""); err != nil {
+		return nil, err
+	}
+	response := struct {
+		CosBaseResponse
+		Data StatFileResult `json:"data"`
+	}{}
+	if err := a.c.doRequestAsJson(request, &response); err != nil {
+		return nil, err
+	}
+	return &response.Data, nil
+
+}
+
+func (a *jsonAPI) putObject(ctx context.Context, fileContent []byte, remote string, cover bool) error {
+	shaSum := sha1.Sum(fileContent)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	writer.WriteField("op", "upload")
+	writer.WriteField("sha", hex.EncodeToString(shaSum[:]))
+	if cover {
+		writer.WriteField("insertOnly", "0")
+	}
+	writer.WriteField("filecontent", string(fileContent))
+	writer.Close()
+
+	request, err := http.NewRequestWithContext(ctx, "POST", a.c.buildResourceURL(remote), body)
+	if err != nil {
+		return err
+	}
+	if err := a.c.authorize(request, ""); err != nil {
+		return err
+	}
+	request.Header.Add("Content-Type", "multipart/form-data; boundary="+writer.Boundary())
+
+	result := CosBaseResponse{}
+	return a.c.doRequestAsJson(request, &result)
+}
+
+// initSlices starts an upload_slice session. sha and parts let the service reject corrupted slices.
+func (a *jsonAPI) initSlices(ctx context.Context, remote string, size, sliceSize int64, sha string, parts []slicePart, cover bool) (string, error) {
+	uploadParts, err := json.Marshal(parts)
+	if err != nil {
+		return "", err
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	writer.WriteField("op", "upload_slice_init")
+	writer.WriteField("filesize", strconv.FormatInt(size, 10))
+	writer.WriteField("slice_size", strconv.FormatInt(sliceSize, 10))
+	writer.WriteField("sha", sha)
+	writer.WriteField("uploadparts", string(uploadParts))
+	if cover {
+		writer.WriteField("insertOnly", "0")
+	}
+	writer.Close()
+
+	request, err := http.NewRequestWithContext(ctx, "POST", a.c.buildResourceURL(remote), body)
+	if err != nil {
+		return "", err
+	}
+	if err := a.c.authorize(request, ""); err != nil {
+		return "", err
+	}
+	request.Header.Add("Content-Type", "multipart/form-data; boundary="+writer.Boundary())
+
+	var response struct {
+		CosBaseResponse
+		Data struct {
+			Session string `json:"session"`
+		} `json:"data"`
+	}
+	if err := a.c.doRequestAsJson(request, &response); err != nil {
+		return "", err
+	}
+	return response.Data.Session, nil
+}
+
+// listSlices asks the service which slices of the unfinished upload to remote it already holds.
+func (a *jsonAPI) listSlices(ctx context.Context, remote string, cp *uploadCheckpoint) (*sliceList, error) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	writer.WriteField("op", "upload_slice_list")
+	writer.Close()
+
+	request, err := http.NewRequestWithContext(ctx, "POST", a.c.buildResourceURL(remote), body)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.c.authorize(request, ""); err != nil {
+		return nil, err
+	}
+	request.Header.Add("Content-Type", "multipart/form-data; boundary="+writer.Boundary())
+
+	var response struct {
+		CosBaseResponse
+		Data sliceList `json:"data"`
+	}
+	if err := a.c.doRequestAsJson(request, &response); err != nil {
+		return nil, err
+	}
+	return &response.Data, nil
+}
+
+func (a *jsonAPI) uploadSlice(ctx context.Context, remote, session string, sliceSize, offset int64, b []byte) error {
+	body := &bytes.Buffer{}
+
+	writer := multipart.NewWriter(body)
+	writer.WriteField("op", "upload_slice_data")
+	writer.WriteField("session", session)
+	writer.WriteField("offset", strconv.FormatInt(offset, 10))
+	field, _ := writer.CreateFormField("filecontent")
+	field.Write(b)
+	writer.Close()
+
+	request, err := http.NewRequestWithContext(ctx, "POST", a.c.buildResourceURL(remote), body)
+	if err != nil {
+		return err
+	}
+	if err := a.c.authorize(request, ""); err != nil {
+		return err
+	}
+	request.Header.Add("Content-Type", "multipart/form-data; boundary="+writer.Boundary())
+
+	response := CosBaseResponse{}
+	return a.c.doRequestAsJson(request, &response)
+}
+
+func (a *jsonAPI) finishSlices(ctx context.Context, remote, session string, size int64) error {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	writer.WriteField("op", "upload_slice_finish")
+	writer.WriteField("filesize", strconv.FormatInt(size, 10))
+	writer.WriteField("session", session)
+	writer.Close()
+
+	request, err := http.NewRequestWithContext(ctx, "POST", a.c.buildResourceURL(remote), body)
+	if err != nil {
+		return err
+	}
+	if err := a.c.authorize(request, ""); err != nil {
+		return err
+	}
+	request.Header.Add("Content-Type", "multipart/form-data; boundary="+writer.Boundary())
+
+	finish := CosBaseResponse{}
+	return a.c.doRequestAsJson(request, &finish)
+}
+
+func (a *jsonAPI) downloadURL(remote string) string {
+	return a.c.buildDownloadUrl(remote)
+}
+
+func (a *jsonAPI) delete(ctx context.Context, path string) error {
+	data := struct {
+		Op string `json:"op"`
+	}{"delete"}
+	body, _ := json.Marshal(data)
+
+	request, err := http.NewRequestWithContext(ctx, "POST", a.c.buildResourceURL(path), bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	if err := a.c.authorize(request, path); err != nil {
+		return err
+	}
+	request.Header.Add("Content-Type", "application/json")
+	result := CosBaseResponse{}
+	return a.c.doRequestAsJson(request, &result)
+}
+
+func (a *jsonAPI) move(ctx context.Context, src, target string, force bool) error {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	writer.WriteField("op", "move")
+	writer.WriteField("dest_fileid", target)
+	if force {
+		writer.WriteField("to_over_write", "1")
+	}
+	writer.Close()
+
+	request, err := http.NewRequestWithContext(ctx, "POST", a.c.buildResourceURL(src), body)
+	if err != nil {
+		return err
+	}
+	if err := a.c.authorize(request, src); err != nil {
+		return err
+	}
+	request.Header.Add("Content-Type", "multipart/form-data; boundary="+writer.Boundary())
+
+	result := CosBaseResponse{}
+	return a.c.doRequestAsJson(request, &result)
+}
+
+func (a *jsonAPI) updateAuthority(ctx context.Context, remote, authority string) error {
+	data := struct {
+		Op        string `json:"op"`
+		Authority string `json:"authority"`
+	}{"update", authority}
+
+	body, _ := json.Marshal(data)
+	request, err := http.NewRequestWithContext(ctx, "POST", a.c.buildResourceURL(remote), bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	if err := a.c.authorize(request, ""); err != nil {
+		return err
+	}
+	request.Header.Add("Content-Type", "application/json")
+
+	response := CosBaseResponse{}
+	return a.c.doRequestAsJson(request, &response)
+}
+
+func (a *jsonAPI) presign(remote string, creds *Credentials, expire time.Time) string {
+	query := url.Values{}
+	query.Set("sign", a.c.signer().File(a.c.AppID, a.c.Bucket, remote, creds, expire))
+	if creds.SessionToken != "" {
+		query.Set(SECURITY_TOKEN_HEADER, creds.SessionToken)
+	}
+	return a.c.buildDownloadUrl(remote) + "?" + query.Encode()
+}
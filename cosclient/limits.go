@@ -0,0 +1,117 @@
+package cosclient
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// UPLOAD_CONCURRENCY is how many slices of a file are sent at once by default.
+	UPLOAD_CONCURRENCY = 10
+	// FILE_CONCURRENCY is how many files directory transfers move at once by default.
+	FILE_CONCURRENCY = 20
+)
+
+// apiLimits are the sizes a protocol accepts for uploads.
+type apiLimits struct {
+	// maxSingleSize is the largest file uploaded with a single request.
+	maxSingleSize int64
+	// sliceSizes lists the only slice sizes accepted; when empty any size from
+	// minSliceSize to maxSliceSize is.
+	sliceSizes   []int64
+	minSliceSize int64
+	maxSliceSize int64
+	// maxSlices bounds the slices of one file, 0 when unbounded.
+	maxSlices int64
+}
+
+// jsonLimits are the limits of the files/v2 API.
+var jsonLimits = apiLimits{
+	maxSingleSize: 20 * 1024 * 1024,
+	sliceSizes:    []int64{512 * 1024, 1024 * 1024, 2 * 1024 * 1024, 3 * 1024 * 1024},
+}
+
+// xmlLimits are the limits of the XML API.
+var xmlLimits = apiLimits{
+	maxSingleSize: 5 * 1024 * 1024 * 1024,
+	minSliceSize:  1024 * 1024,
+	maxSliceSize:  5 * 1024 * 1024 * 1024,
+	maxSlices:     10000,
+}
+
+// limits returns the name and the limits of the API of the client.
+func (c *CosClient) limits() (string, apiLimits) {
+	if c.API == API_XML {
+		return API_XML, xmlLimits
+	}
+	return API_JSON, jsonLimits
+}
+
+// uploadParts returns the size above which files are uploaded in slices, the slice size
+// and how many slices of a file are sent at once, checked against the limits of the API.
+func (c *CosClient) uploadParts() (threshold, sliceSize int64, concurrency int, err error) {
+	threshold, sliceSize, concurrency = c.UploadThreshold, c.UploadPartSize, c.UploadConcurrency
+	if threshold <= 0 {
+		threshold = MAX_SINGLE_SIZE
+	}
+	if sliceSize <= 0 {
+		sliceSize = UPLOAD_SLICE_BLOCK_SIZE
+	}
+	if concurrency <= 0 {
+		concurrency = UPLOAD_CONCURRENCY
+	}
+
+	api, limits := c.limits()
+	if threshold > limits.maxSingleSize {
+		return 0, 0, 0, fmt.Errorf("UploadThreshold: %d exceeds %d, the largest single upload of the %s API", threshold, limits.maxSingleSize, api)
+	}
+	if len(limits.sliceSizes) > 0 {
+		names := make([]string, len(limits.sliceSizes))
+		for i, size := range limits.sliceSizes {
+			if size == sliceSize {
+				return threshold, sliceSize, concurrency, nil
+			}
+			names[i] = fmt.Sprint(size)
+		}
+		return 0, 0, 0, fmt.Errorf("UploadPartSize: the %s API takes slices of %s bytes, not %d", api, strings.Join(names, ", "), sliceSize)
+	}
+	if sliceSize < limits.minSliceSize || sliceSize > limits.maxSliceSize {
+		return 0, 0, 0, fmt.Errorf("UploadPartSize: the %s API takes slices of %d to %d bytes, not %d", api, limits.minSliceSize, limits.maxSliceSize, sliceSize)
+	}
+	return threshold, sliceSize, concurrency, nil
+}
+
+// CheckUploadSettings returns an error when UploadThreshold or UploadPartSize is outside
+// the limits of the API, the error every upload would fail with.
+func (c *CosClient) CheckUploadSettings() error {
+	_, _, _, err := c.uploadParts()
+	return err
+}
+
+// fitSlices returns the slice size of a file of size bytes. When sliceSize makes more slices
+// than the API accepts it is grown in steps of UPLOAD_SLICE_BLOCK_SIZE until the file fits,
+// unless UploadPartSize set it explicitly.
+func (c *CosClient) fitSlices(size, sliceSize int64) (int64, error) {
+	_, limits := c.limits()
+	if limits.maxSlices <= 0 || (size+sliceSize-1)/sliceSize <= limits.maxSlices {
+		return sliceSize, nil
+	}
+	if c.UploadPartSize > 0 {
+		return 0, fmt.Errorf("UploadPartSize: %d bytes make more than %d slices of %d bytes", size, limits.maxSlices, sliceSize)
+	}
+	sliceSize = (size + limits.maxSlices - 1) / limits.maxSlices
+	sliceSize = (sliceSize + UPLOAD_SLICE_BLOCK_SIZE - 1) / UPLOAD_SLICE_BLOCK_SIZE * UPLOAD_SLICE_BLOCK_SIZE
+	if sliceSize > limits.maxSliceSize {
+		return 0, fmt.Errorf("%d bytes exceed the largest upload of %d slices of %d bytes", size, limits.maxSlices, limits.maxSliceSize)
+	}
+	return sliceSize, nil
+}
+
+// EffectiveFileConcurrency returns how many files directory transfers move at once,
+// FileConcurrency or FILE_CONCURRENCY when it is not set.
+func (c *CosClient) EffectiveFileConcurrency() int {
+	if c.FileConcurrency <= 0 {
+		return FILE_CONCURRENCY
+	}
+	return c.FileConcurrency
+}
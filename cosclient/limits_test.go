@@ -0,0 +1,77 @@
+package cosclient_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"gocos/cosclient"
+	"gocos/cosfake"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestUploadSettings(t *testing.T) {
+	for _, c := range []struct {
+		api                 string
+		threshold, partSize int64
+		expected            string
+	}{
+		{cosclient.API_JSON, 0, 5000, "UploadPartSize"},
+		{cosclient.API_JSON, 0, 4 << 20, "UploadPartSize"},
+		{cosclient.API_JSON, 32 << 20, 0, "UploadThreshold"},
+		{cosclient.API_XML, 0, 512 << 10, "UploadPartSize"},
+		{cosclient.API_XML, 6 << 30, 0, "UploadThreshold"},
+	} {
+		client := &cosclient.CosClient{API: c.api, UploadThreshold: c.threshold, UploadPartSize: c.partSize}
+		_, err := client.UploadReader(context.Background(), strings.NewReader("x"), "/x.txt", cosclient.UploadOptions{})
+		if err == nil || !strings.HasPrefix(err.Error(), c.expected) {
+			t.Errorf("%s API with threshold %d and part size %d: %v, expected a %s error", c.api, c.threshold, c.partSize, err, c.expected)
+		}
+	}
+}
+
+func TestConcurrentUpload(t *testing.T) {
+	server := cosfake.New()
+	defer server.Close()
+	client := server.Client()
+	client.CheckpointDir = t.TempDir()
+	client.FileConcurrency = 4
+	client.UploadThreshold = 1 << 20
+	client.UploadPartSize = 512 << 10
+	client.UploadConcurrency = 2
+
+	dir := t.TempDir()
+	files := map[string][]byte{}
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("f%d.bin", i)
+		files[name] = bytes.Repeat([]byte{byte('a' + i)}, i*300<<10+1)
+		if err := ioutil.WriteFile(filepath.Join(dir, name), files[name], 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var mu sync.Mutex
+	results := 0
+	err := client.Upload(dir, "/up/", false, nil, func(result *cosclient.UploadResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		results++
+		if result.Err != nil {
+			t.Errorf("upload %s: %s", result.Local, result.Err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results != len(files) {
+		t.Errorf("%d results for %d files", results, len(files))
+	}
+	for name, data := range files {
+		if remote, ok := server.Get("/up/" + name); !ok || !bytes.Equal(remote, data) {
+			t.Errorf("/up/%s not uploaded", name)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package cosclient
+
+import "sync"
+
+const (
+	PROGRESS_UPLOAD   = "upload"
+	PROGRESS_DOWNLOAD = "download"
+)
+
+// Progress is the state of one file transfer, passed to CosClient.OnProgress.
+type Progress struct {
+	// Op is PROGRESS_UPLOAD or PROGRESS_DOWNLOAD.
+	Op     string
+	Local  string
+	Remote string
+	// Bytes of the Total size of the file have been transferred.
+	Bytes int64
+	Total int64
+	// Done is set on the last report of the transfer, with Err when it failed.
+	Done bool
+	Err  error
+}
+
+// progress counts the bytes of a transfer and reports them to OnProgress; a nil
+// *progress, for clients without OnProgress, counts nothing.
+type progress struct {
+	mu       sync.Mutex
+	state    Progress
+	callback func(Progress)
+}
+
+func (c *CosClient) progress(op, local, remote string, total int64) *progress {
+	if c.OnProgress == nil {
+		return nil
+	}
+	p := &progress{state: Progress{Op: op, Local: local, Remote: remote, Total: total}, callback: c.OnProgress}
+	p.report()
+	return p
+}
+
+// add counts n more bytes transferred.
+func (p *progress) add(n int64) {
+	if p == nil || n == 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.state.Bytes += n
+	p.report()
+}
+
+// done reports the end of the transfer.
+func (p *progress) done(err error) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.state.Done, p.state.Err = true, err
+	p.report()
+}
+
+// report passes the state to the callback, the caller holds mu so reports of a transfer
+// never overlap.
+func (p *progress) report() {
+	p.callback(p.state)
+}
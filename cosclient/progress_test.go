@@ -0,0 +1,74 @@
+package cosclient_test
+
+import (
+	"bytes"
+	"gocos/cosclient"
+	"gocos/cosfake"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// recordProgress collects the reports of client by transfer.
+func recordProgress(client *cosclient.CosClient) (map[string][]cosclient.Progress, *sync.Mutex) {
+	reports := map[string][]cosclient.Progress{}
+	mu := &sync.Mutex{}
+	client.OnProgress = func(p cosclient.Progress) {
+		mu.Lock()
+		defer mu.Unlock()
+		reports[p.Op+" "+p.Remote] = append(reports[p.Op+" "+p.Remote], p)
+	}
+	return reports, mu
+}
+
+func checkProgress(t *testing.T, name string, reports []cosclient.Progress, size int64) {
+	t.Helper()
+	if len(reports) < 2 {
+		t.Fatalf("%s: %d progress reports", name, len(reports))
+	}
+	for i := 1; i < len(reports); i++ {
+		if reports[i].Bytes < reports[i-1].Bytes || reports[i-1].Done {
+			t.Errorf("%s: report %+v after %+v", name, reports[i], reports[i-1])
+		}
+	}
+	last := reports[len(reports)-1]
+	if !last.Done || last.Err != nil || last.Bytes != size || last.Total != size {
+		t.Errorf("%s: last report %+v, expected %d bytes done", name, last, size)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	server := cosfake.New()
+	defer server.Close()
+	client := server.Client()
+	client.CheckpointDir = t.TempDir()
+	client.DownloadPartSize = 1 << 20
+	reports, mu := recordProgress(client)
+
+	dir := t.TempDir()
+	small := filepath.Join(dir, "small.txt")
+	large := filepath.Join(dir, "large.bin")
+	largeData := bytes.Repeat([]byte("x"), int(cosclient.MAX_SINGLE_SIZE)+12345)
+	ioutil.WriteFile(small, []byte("small"), 0644)
+	ioutil.WriteFile(large, largeData, 0644)
+
+	for _, c := range []struct {
+		local, remote string
+		size          int64
+	}{
+		{small, "/small.txt", 5},
+		{large, "/large.bin", int64(len(largeData))},
+	} {
+		if err := client.UploadFile(c.local, c.remote, false); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.Download(c.remote, c.local+".down"); err != nil {
+			t.Fatal(err)
+		}
+		mu.Lock()
+		checkProgress(t, "upload "+c.remote, reports[cosclient.PROGRESS_UPLOAD+" "+c.remote], c.size)
+		checkProgress(t, "download "+c.remote, reports[cosclient.PROGRESS_DOWNLOAD+" "+c.remote], c.size)
+		mu.Unlock()
+	}
+}
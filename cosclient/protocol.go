@@ -0,0 +1,48 @@
+package cosclient
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+const (
+	// API_JSON is the legacy JSON API under <region>.file.myqcloud.com/files/v2/.
+	API_JSON = "json"
+	// API_XML is the XML API under <bucket>-<appid>.cos.<region>.myqcloud.com.
+	API_XML = "xml"
+)
+
+// protocol is how the client talks to cos. The client keeps what does not depend on the
+// API, like walking directories, running slices concurrently, checkpoints and retries, and
+// leaves the requests to its protocol.
+type protocol interface {
+	// authorize signs request with creds; file is the path of a single-file operation, or "".
+	authorize(request *http.Request, creds *Credentials, file string)
+
+	list(ctx context.Context, path string, listContext string) (*ListResponse, error)
+	stat(ctx context.Context, path string) (*StatFileResult, error)
+	putObject(ctx context.Context, content []byte, remote string, cover bool) error
+
+	// initSlices starts a slice upload of size bytes in slices of sliceSize and returns its session.
+	initSlices(ctx context.Context, remote string, size, sliceSize int64, sha string, parts []slicePart, cover bool) (string, error)
+	// listSlices returns the slices of the unfinished upload of cp held by the service.
+	listSlices(ctx context.Context, remote string, cp *uploadCheckpoint) (*sliceList, error)
+	uploadSlice(ctx context.Context, remote, session string, sliceSize, offset int64, b []byte) error
+	finishSlices(ctx context.Context, remote, session string, size int64) error
+
+	// downloadURL is the URL a signed GET, possibly with a Range, downloads remote from.
+	downloadURL(remote string) string
+	delete(ctx context.Context, path string) error
+	move(ctx context.Context, src, target string, force bool) error
+	updateAuthority(ctx context.Context, remote, authority string) error
+	presign(remote string, creds *Credentials, expire time.Time) string
+}
+
+// protocol returns the protocol of the API selected by the API field.
+func (c *CosClient) protocol() protocol {
+	if c.API == API_XML {
+		return &xmlAPI{c}
+	}
+	return &jsonAPI{c}
+}
@@ -0,0 +1,184 @@
+package cosclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RateWindow limits transfers to Rate bytes per second from From to To, local times of
+// day like "09:00" and "18:30"; a window with From after To spans midnight and one with
+// From equal to To covers the whole day. Rate 0 lifts the limit during the window.
+type RateWindow struct {
+	From string
+	To   string
+	Rate int64 `json:",omitempty"`
+}
+
+// rateLimiter is a token bucket shared by every upload and download of a client. Request
+// and response bodies take the tokens of each read as it passes and sleep off the debt, so
+// the concurrent transfers together stay within the rate of the moment.
+type rateLimiter struct {
+	mu      sync.Mutex
+	rate    func(now time.Time) int64
+	tokens  float64
+	last    time.Time
+	limited bool
+}
+
+// limiter returns the rate limiter of the client, built on first use, or nil when neither
+// LimitRate nor RateSchedule is set.
+func (c *CosClient) limiter() (*rateLimiter, error) {
+	c.rateOnce.Do(func() {
+		c.rate, c.rateErr = c.buildLimiter()
+	})
+	return c.rate, c.rateErr
+}
+
+func (c *CosClient) buildLimiter() (*rateLimiter, error) {
+	if c.LimitRate <= 0 && len(c.RateSchedule) == 0 {
+		return nil, nil
+	}
+	type window struct{ from, to, rate int64 }
+	windows := make([]window, len(c.RateSchedule))
+	for i, w := range c.RateSchedule {
+		from, err := minuteOfDay(w.From)
+		if err != nil {
+			return nil, fmt.Errorf("RateSchedule: %w", err)
+		}
+		to, err := minuteOfDay(w.To)
+		if err != nil {
+			return nil, fmt.Errorf("RateSchedule: %w", err)
+		}
+		if w.Rate < 0 {
+			return nil, fmt.Errorf("RateSchedule: negative rate %d", w.Rate)
+		}
+		windows[i] = window{from, to, w.Rate}
+	}
+	limit := c.LimitRate
+	return &rateLimiter{rate: func(now time.Time) int64 {
+		minute := int64(now.Hour()*60 + now.Minute())
+		for _, w := range windows {
+			if w.from == w.to ||
+				w.from < w.to && w.from <= minute && minute < w.to ||
+				w.from > w.to && (minute >= w.from || minute < w.to) {
+				return w.rate
+			}
+		}
+		return limit
+	}}, nil
+}
+
+// minuteOfDay parses a time of day like "09:30".
+func minuteOfDay(value string) (int64, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", value)
+	}
+	return int64(t.Hour()*60 + t.Minute()), nil
+}
+
+// take waits until n more bytes may be transferred. Up to a second of the rate can be
+// taken at once after an idle period.
+func (l *rateLimiter) take(ctx context.Context, n int64) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	rate := l.rate(now)
+	if rate <= 0 {
+		l.limited = false
+		l.mu.Unlock()
+		return nil
+	}
+	if !l.limited {
+		// a new limited period starts with a full bucket
+		l.tokens, l.last, l.limited = float64(rate), now, true
+	}
+	l.tokens += now.Sub(l.last).Seconds() * float64(rate)
+	if l.tokens > float64(rate) {
+		l.tokens = float64(rate)
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	debt := l.tokens
+	l.mu.Unlock()
+
+	if debt >= 0 {
+		return nil
+	}
+	if !sleep(ctx, time.Duration(-debt/float64(rate)*float64(time.Second))) {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// throttle waits until n more bytes may be transferred under LimitRate and RateSchedule.
+func (c *CosClient) throttle(ctx context.Context, n int64) error {
+	l, err := c.limiter()
+	if err != nil {
+		return err
+	}
+	return l.take(ctx, n)
+}
+
+// throttledReader limits the bytes read from r to the rate of the client.
+type throttledReader struct {
+	ctx context.Context
+	c   *CosClient
+	r   io.Reader
+}
+
+// throttleReader returns r limited to LimitRate and RateSchedule.
+func (c *CosClient) throttleReader(ctx context.Context, r io.Reader) io.Reader {
+	if c.LimitRate <= 0 && len(c.RateSchedule) == 0 {
+		return r
+	}
+	return &throttledReader{ctx, c, r}
+}
+
+// throttleRequest returns a copy of request whose body is read no faster than the rate of
+// the client, taking tokens as the transport writes it out. The bodies GetBody rewinds for
+// redirects and the transport's own retries are throttled as well.
+func (c *CosClient) throttleRequest(request *http.Request) (*http.Request, error) {
+	if c.LimitRate <= 0 && len(c.RateSchedule) == 0 || request.Body == nil || request.Body == http.NoBody {
+		return request, nil
+	}
+	// an invalid RateSchedule must fail here, not as a retryable error of the transport
+	if _, err := c.limiter(); err != nil {
+		return nil, err
+	}
+	ctx := request.Context()
+	throttled := request.Clone(ctx)
+	throttled.Body = c.throttleBody(ctx, request.Body)
+	if getBody := request.GetBody; getBody != nil {
+		throttled.GetBody = func() (io.ReadCloser, error) {
+			body, err := getBody()
+			if err != nil {
+				return nil, err
+			}
+			return c.throttleBody(ctx, body), nil
+		}
+	}
+	return throttled, nil
+}
+
+// throttleBody is body read through throttleReader.
+func (c *CosClient) throttleBody(ctx context.Context, body io.ReadCloser) io.ReadCloser {
+	return struct {
+		io.Reader
+		io.Closer
+	}{c.throttleReader(ctx, body), body}
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if e := r.c.throttle(r.ctx, int64(n)); e != nil {
+		return n, e
+	}
+	return n, err
+}
@@ -0,0 +1,163 @@
+package cosclient_test
+
+import (
+	"bytes"
+	"gocos/cosclient"
+	"gocos/cosfake"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLimitRate(t *testing.T) {
+	server := cosfake.New()
+	defer server.Close()
+	dir := t.TempDir()
+	local := filepath.Join(dir, "f.bin")
+	data := bytes.Repeat([]byte("x"), 5<<19)
+	if err := ioutil.WriteFile(local, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name      string
+		limit     int64
+		schedule  []cosclient.RateWindow
+		throttled bool
+	}{
+		{"LimitRate", 1 << 20, nil, true},
+		{"schedule", 0, []cosclient.RateWindow{{From: "00:00", To: "00:00", Rate: 1 << 20}}, true},
+		{"schedule lifting LimitRate", 1, []cosclient.RateWindow{{From: "00:00", To: "00:00"}}, false},
+	} {
+		client := server.Client()
+		client.CheckpointDir = t.TempDir()
+		client.UploadThreshold = 1 << 20
+		client.DownloadPartSize = 1 << 20
+		client.LimitRate = c.limit
+		client.RateSchedule = c.schedule
+		var mu sync.Mutex
+		var longest time.Duration
+		client.Middleware = []cosclient.Middleware{func(next http.RoundTripper) http.RoundTripper {
+			return cosclient.RoundTripperFunc(func(request *http.Request) (*http.Response, error) {
+				if request.Body != nil {
+					request = request.Clone(request.Context())
+					request.Body = &spanReader{ReadCloser: request.Body, record: func(d time.Duration) {
+						mu.Lock()
+						defer mu.Unlock()
+						if d > longest {
+							longest = d
+						}
+					}}
+				}
+				return next.RoundTrip(request)
+			})
+		}}
+
+		// the first second of the rate passes at once, the other 1.5MB take 1.5s
+		start := time.Now()
+		if err := client.UploadFile(local, "/"+c.name, true); err != nil {
+			t.Fatal(err)
+		}
+		if elapsed := time.Since(start); (elapsed >= time.Second) != c.throttled {
+			t.Errorf("%s: upload took %s", c.name, elapsed)
+		}
+		// throttled slices are held back as they are written, not before they are sent
+		if (longest >= 500*time.Millisecond) != c.throttled {
+			t.Errorf("%s: the longest request body took %s to send", c.name, longest)
+		}
+		start = time.Now()
+		if _, err := client.Download("/"+c.name, local+".down"); err != nil {
+			t.Fatal(err)
+		}
+		if elapsed := time.Since(start); (elapsed >= time.Second) != c.throttled {
+			t.Errorf("%s: download took %s", c.name, elapsed)
+		}
+	}
+}
+
+// spanReader records how long the reads of a body take, from the first one to io.EOF.
+type spanReader struct {
+	io.ReadCloser
+	record func(time.Duration)
+	first  time.Time
+}
+
+func (r *spanReader) Read(p []byte) (int, error) {
+	if r.first.IsZero() {
+		r.first = time.Now()
+	}
+	n, err := r.ReadCloser.Read(p)
+	if err == io.EOF {
+		r.record(time.Since(r.first))
+	}
+	return n, err
+}
+
+func TestRateScheduleInvalid(t *testing.T) {
+	server := cosfake.New()
+	defer server.Close()
+	client := server.Client()
+	client.RateSchedule = []cosclient.RateWindow{{From: "9am", To: "18:00", Rate: 1024}}
+	local := filepath.Join(t.TempDir(), "a.txt")
+	if err := ioutil.WriteFile(local, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.UploadFile(local, "/a.txt", true); err == nil || !strings.HasPrefix(err.Error(), "RateSchedule") {
+		t.Errorf("upload with an invalid RateSchedule: %v", err)
+	}
+}
+
+func TestLimitRateResentBody(t *testing.T) {
+	server := cosfake.New()
+	defer server.Close()
+	local := filepath.Join(t.TempDir(), "f.bin")
+	if err := ioutil.WriteFile(local, bytes.Repeat([]byte("x"), 5<<19), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the client rewinds the body with GetBody to follow a 307, the retry policy to retry a 503
+	for _, status := range []int{http.StatusTemporaryRedirect, http.StatusServiceUnavailable} {
+		client := server.Client()
+		client.LimitRate = 1 << 20
+		client.Retry = &cosclient.RetryPolicy{MaxAttempts: 2, InitialBackoff: cosclient.Duration(time.Millisecond)}
+		var mu sync.Mutex
+		var failed bool
+		var resent time.Duration
+		client.Middleware = []cosclient.Middleware{func(next http.RoundTripper) http.RoundTripper {
+			return cosclient.RoundTripperFunc(func(request *http.Request) (*http.Response, error) {
+				if request.Body == nil || request.Body == http.NoBody {
+					return next.RoundTrip(request)
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				if !failed {
+					failed = true
+					request.Body.Close()
+					return &http.Response{
+						StatusCode: status,
+						Status:     http.StatusText(status),
+						Header:     http.Header{"Location": {request.URL.String()}},
+						Body:       http.NoBody,
+						Request:    request,
+					}, nil
+				}
+				request = request.Clone(request.Context())
+				request.Body = &spanReader{ReadCloser: request.Body, record: func(d time.Duration) { resent = d }}
+				return next.RoundTrip(request)
+			})
+		}}
+
+		// the first second of the rate passes at once, the other 1.5MB take 1.5s
+		if err := client.UploadFile(local, "/f.bin", true); err != nil {
+			t.Fatal(err)
+		}
+		if !failed || resent < 500*time.Millisecond {
+			t.Errorf("after a %d, the body took %s to send again", status, resent)
+		}
+	}
+}
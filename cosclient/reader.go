@@ -0,0 +1,77 @@
+package cosclient
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// UploadOptions tunes UploadReader.
+type UploadOptions struct {
+	// Cover overwrites an existing file at remote.
+	Cover bool
+	// TempDir holds the spool file of large streams, defaults to os.TempDir().
+	TempDir string
+}
+
+// UploadReader uploads everything read from r to remote without knowing its size up front.
+// Streams up to UploadThreshold are uploaded from memory with a single request. Larger ones
+// are spooled to a temporary file first, because upload_slice_init needs the total size and
+// the sha of every slice, and are then sent slice by slice; the XML API needs the sha of the
+// whole stream when the multipart upload starts, so it is spooled as well. TempDir must hold
+// as many free bytes as the stream has.
+// It returns the number of bytes read from r.
+func (c *CosClient) UploadReader(ctx context.Context, r io.Reader, remote string, opts UploadOptions) (int64, error) {
+	threshold, _, _, err := c.uploadParts()
+	if err != nil {
+		return 0, err
+	}
+	head, err := ioutil.ReadAll(io.LimitReader(r, threshold+1))
+	if err != nil {
+		return int64(len(head)), err
+	}
+	if int64(len(head)) <= threshold {
+		p := c.progress(PROGRESS_UPLOAD, "-", remote, int64(len(head)))
+		err := c.uploadBytes(ctx, head, remote, opts.Cover)
+		if err == nil {
+			p.add(int64(len(head)))
+		}
+		p.done(err)
+		return int64(len(head)), err
+	}
+
+	spool, err := ioutil.TempFile(opts.TempDir, "gocos-")
+	if err != nil {
+		return int64(len(head)), err
+	}
+	defer func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}()
+	if _, err := spool.Write(head); err != nil {
+		return int64(len(head)), err
+	}
+	n, err := io.Copy(spool, contextReader{ctx, r})
+	size := int64(len(head)) + n
+	if err != nil {
+		return size, err
+	}
+	p := c.progress(PROGRESS_UPLOAD, "-", remote, size)
+	err = c.uploadSlices(ctx, spool, spool.Name(), remote, opts.Cover, false, p)
+	p.done(err)
+	return size, err
+}
+
+// contextReader stops reading once ctx is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
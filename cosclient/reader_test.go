@@ -0,0 +1,39 @@
+package cosclient_test
+
+import (
+	"bytes"
+	"context"
+	"gocos/cosclient"
+	"gocos/cosfake"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestUploadReader(t *testing.T) {
+	server := cosfake.New()
+	defer server.Close()
+	client := server.Client()
+	client.UploadThreshold = 1 << 20
+	client.UploadPartSize = 512 << 10
+
+	for _, size := range []int{0, 1 << 20, 3<<20 + 1} {
+		data := bytes.Repeat([]byte("0123456789abcdef"), size/16+1)[:size]
+		spool := t.TempDir()
+		// hide the Seeker of bytes.Reader, like stdin
+		r := io.MultiReader(bytes.NewReader(data))
+		n, err := client.UploadReader(context.Background(), r, "/stream.bin", cosclient.UploadOptions{Cover: true, TempDir: spool})
+		if err != nil {
+			t.Fatalf("%d bytes: %v", size, err)
+		}
+		if n != int64(size) {
+			t.Errorf("%d bytes: read %d", size, n)
+		}
+		if uploaded, _ := server.Get("/stream.bin"); !bytes.Equal(uploaded, data) {
+			t.Errorf("%d bytes: uploaded %d", size, len(uploaded))
+		}
+		if left, _ := ioutil.ReadDir(spool); len(left) != 0 {
+			t.Errorf("%d bytes: spool files %v left", size, left)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package cosclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy decides how failed requests are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the number of tries including the first one; 1 disables retries.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry, doubled for every further retry.
+	InitialBackoff Duration
+	// MaxBackoff caps the wait between two tries.
+	MaxBackoff Duration
+	// Jitter randomly shortens each wait by up to this fraction, in [0, 1].
+	Jitter float64
+	// RetryableCodes are the cos error codes worth retrying; transport errors and
+	// 429 / 5xx responses are always retried.
+	RetryableCodes []int
+}
+
+// DefaultRetryPolicy is used by clients without a Retry policy.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: Duration(500 * time.Millisecond),
+	MaxBackoff:     Duration(10 * time.Second),
+	Jitter:         0.2,
+	RetryableCodes: []int{-71},
+}
+
+// Duration is a time.Duration read from JSON as a string like "500ms" or a number of nanoseconds.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	switch value := v.(type) {
+	case float64:
+		*d = Duration(value)
+	case string:
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*d = Duration(parsed)
+	default:
+		return errors.New("invalid duration")
+	}
+	return nil
+}
+
+func (c *CosClient) retryPolicy() *RetryPolicy {
+	if c.Retry != nil {
+		return c.Retry
+	}
+	return &DefaultRetryPolicy
+}
+
+// backoff returns the wait before try attempt+1.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	delay := time.Duration(p.InitialBackoff)
+	for i := 1; i < attempt && delay < time.Duration(p.MaxBackoff); i++ {
+		delay *= 2
+	}
+	if p.MaxBackoff > 0 && delay > time.Duration(p.MaxBackoff) {
+		delay = time.Duration(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		delay -= time.Duration(rand.Float64() * p.Jitter * float64(delay))
+	}
+	return delay
+}
+
+// retryable reports whether err may succeed when tried again.
+func (p *RetryPolicy) retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var cosErr *CosError
+	if errors.As(err, &cosErr) {
+		for _, code := range p.RetryableCodes {
+			if code == cosErr.Code {
+				return true
+			}
+		}
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+	var we *writeError
+	if errors.As(err, &we) {
+		return false
+	}
+	// only failures of the connection are transient, not ones like an unsupported scheme that
+	// http.Client.Do reports as a *url.Error as well
+	var netErr net.Error
+	if errors.As(err, &netErr) && (netErr.Timeout() || netErr.Temporary()) {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// wait sleeps before retrying after a failed try, reporting it to OnRetry.
+// It returns false when no retry should be made.
+func (c *CosClient) wait(ctx context.Context, what string, attempt int, err error) bool {
+	p := c.retryPolicy()
+	if attempt >= p.MaxAttempts || !p.retryable(err) {
+		return false
+	}
+	if c.OnRetry != nil {
+		c.OnRetry(what, attempt, err)
+	}
+	return sleep(ctx, p.backoff(attempt))
+}
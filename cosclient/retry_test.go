@@ -0,0 +1,59 @@
+package cosclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestRetryable(t *testing.T) {
+	p := &RetryPolicy{RetryableCodes: []int{-71}}
+	for _, c := range []struct {
+		err       error
+		retryable bool
+	}{
+		{&url.Error{Op: "Get", URL: "ftp://example.invalid/", Err: errors.New(`unsupported protocol scheme "ftp"`)}, false},
+		{&url.Error{Op: "Get", URL: "http://example.invalid/", Err: &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}}, true},
+		{&url.Error{Op: "Post", URL: "http://example.invalid/", Err: &net.OpError{Op: "write", Net: "tcp", Err: os.NewSyscallError("write", syscall.EPIPE)}}, true},
+		{&url.Error{Op: "Get", URL: "http://example.invalid/", Err: &net.DNSError{Err: "no such host", Name: "example.invalid", IsNotFound: true}}, false},
+		{&net.DNSError{Err: "i/o timeout", Name: "example.invalid", IsTimeout: true}, true},
+		{fmt.Errorf("download /a.txt: %w", ErrReadTimeout), true},
+		{fmt.Errorf("download /a.txt: %w", io.ErrUnexpectedEOF), true},
+		{&StatusError{503, "503 Service Unavailable"}, true},
+		{&StatusError{404, "404 Not Found"}, false},
+		{&CosError{-71, "busy"}, true},
+		{&CosError{-197, "not found"}, false},
+		{&url.Error{Op: "Get", URL: "http://example.invalid/", Err: context.Canceled}, false},
+		{errors.New("TLSMinVersion: unknown version"), false},
+	} {
+		if retryable := p.retryable(c.err); retryable != c.retryable {
+			t.Errorf("retryable(%v) = %v, expected %v", c.err, retryable, c.retryable)
+		}
+	}
+}
+
+func TestRetryBadScheme(t *testing.T) {
+	retries := 0
+	client := &CosClient{
+		AppID:     "1250000000",
+		SecretID:  "id",
+		SecretKey: "key",
+		Bucket:    "fake",
+		Endpoint:  "ftp://example.invalid",
+		Retry:     &RetryPolicy{MaxAttempts: 3},
+		OnRetry:   func(string, int, error) { retries++ },
+	}
+	if _, err := client.List("/"); err == nil || !strings.Contains(err.Error(), "unsupported protocol scheme") {
+		t.Errorf("List with an ftp endpoint: %v", err)
+	}
+	if retries != 0 {
+		t.Errorf("unsupported protocol scheme retried %d times", retries)
+	}
+}
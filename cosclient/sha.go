@@ -0,0 +1,89 @@
+package cosclient
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+)
+
+// ErrShaMismatch is returned when a downloaded file does not match the sha recorded by cos.
+var ErrShaMismatch = errors.New("sha1 mismatch")
+
+// slicePart describes one slice of a slice upload for upload_slice_init.
+type slicePart struct {
+	Offset  int64  `json:"offset"`
+	DataLen int64  `json:"datalen"`
+	DataSha string `json:"datasha"`
+}
+
+// sliceShas reads file once and returns the sha1 of the whole file and the parts of
+// upload_slice_init. As the service expects, the datasha of a part is the running sha1 of
+// the file up to the end of its slice: the five words of the hash state before padding, and
+// for the last part the sha1 of the whole file.
+func sliceShas(ctx context.Context, file *os.File, size, sliceSize int64) (string, []slicePart, error) {
+	whole := sha1.New()
+	parts := make([]slicePart, 0, size/sliceSize+1)
+	for offset := int64(0); offset < size; offset += sliceSize {
+		if ctx.Err() != nil {
+			return "", nil, ctx.Err()
+		}
+		n, err := io.Copy(whole, io.NewSectionReader(file, offset, sliceSize))
+		if err != nil {
+			return "", nil, err
+		}
+		sha, err := shaState(whole)
+		if err != nil {
+			return "", nil, err
+		}
+		parts = append(parts, slicePart{offset, n, sha})
+	}
+	sha := hex.EncodeToString(whole.Sum(nil))
+	if len(parts) > 0 {
+		parts[len(parts)-1].DataSha = sha
+	}
+	return sha, parts, nil
+}
+
+// shaState returns the hex of the five state words of a sha1 hash, the running sha1 of the
+// complete 64-byte blocks written so far.
+func shaState(h hash.Hash) (string, error) {
+	state, err := h.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+	// the marshalled state starts with a 4-byte magic followed by the words
+	return hex.EncodeToString(state[4:24]), nil
+}
+
+// FileSha returns the hex sha1 of the local file, as cos reports it for remote files.
+func FileSha(local string) (string, error) {
+	file, err := os.Open(local)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha1.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// verifySha compares the sha1 of the local file with the one cos reported.
+func verifySha(local, expected string) error {
+	actual, err := FileSha(local)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("%w: cos has %s, local is %s", ErrShaMismatch, expected, actual)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package cosclient
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSliceShas(t *testing.T) {
+	data := make([]byte, 384)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	local := filepath.Join(t.TempDir(), "data")
+	if err := ioutil.WriteFile(local, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	sha, parts, err := sliceShas(context.Background(), file, int64(len(data)), 128)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the sha1 state words after 128 and 256 bytes, computed apart from crypto/sha1
+	expected := []slicePart{
+		{0, 128, "e02bacbe12f1f8e702864ddce8636b74aa460de0"},
+		{128, 128, "13fb66c9103abba4259e76b67094e2ae68fbf903"},
+		{256, 128, "43e186e32ee78c9e6b9de8da6539cbe961359a6a"},
+	}
+	if sha != "43e186e32ee78c9e6b9de8da6539cbe961359a6a" || !reflect.DeepEqual(parts, expected) {
+		t.Errorf("sliceShas returned %s and %v, expected the sha1 of the file and %v", sha, parts, expected)
+	}
+}
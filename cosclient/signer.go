@@ -0,0 +1,236 @@
+package cosclient
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MULTI_SIGNATURE_TTL is how long a multi-use signature is valid, the most cos allows.
+const MULTI_SIGNATURE_TTL = 90 * 24 * time.Hour
+
+// SIGNATURE_REFRESH_WINDOW is how long before it expires a cached signature is replaced.
+// Signatures living less than 4 windows, like those of short temporary credentials, are
+// replaced in the last quarter of their lifetime instead.
+const SIGNATURE_REFRESH_WINDOW = time.Hour
+
+// Signer creates the signatures of a client's requests. The multi-use signature of each
+// bucket is cached and replaced shortly before it expires or once the credentials change.
+// The zero value is ready to use and a Signer is safe for concurrent use.
+type Signer struct {
+	// Now returns the current time, time.Now when nil.
+	Now func() time.Time
+	// Rand is the source of the random number in signatures, seeded with the time when nil.
+	Rand rand.Source
+
+	mu     sync.Mutex
+	random *rand.Rand
+	cache  map[bucketKey]cachedSignature
+}
+
+type bucketKey struct {
+	appID, bucket string
+}
+
+// cachedSignature is the latest signature of a bucket, only kept for the credentials
+// it was made with so rotated keys do not pile up.
+type cachedSignature struct {
+	secretID, secretKey, sessionToken string
+	signature                         string
+	refresh                           time.Time
+}
+
+// Multi returns a signature valid for every request on bucket until MULTI_SIGNATURE_TTL
+// passes or the temporary creds expire, whichever comes first.
+func (s *Signer) Multi(appID, bucket string, creds *Credentials) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	key := bucketKey{appID, bucket}
+	cached, ok := s.cache[key]
+	if ok && cached.secretID == creds.SecretID && cached.secretKey == creds.SecretKey &&
+		cached.sessionToken == creds.SessionToken && now.Before(cached.refresh) {
+		return cached.signature
+	}
+
+	expire := now.Add(MULTI_SIGNATURE_TTL)
+	if !creds.Expiration.IsZero() && creds.Expiration.Before(expire) {
+		expire = creds.Expiration
+	}
+	signature := s.sign(appID, bucket, "", creds, now, expire.Unix())
+	window := SIGNATURE_REFRESH_WINDOW
+	if quarter := expire.Sub(now) / 4; quarter < window {
+		window = quarter
+	}
+	if s.cache == nil {
+		s.cache = map[bucketKey]cachedSignature{}
+	}
+	s.cache[key] = cachedSignature{creds.SecretID, creds.SecretKey, creds.SessionToken, signature, expire.Add(-window)}
+	return signature
+}
+
+// Once returns a signature valid for a single request on file, which is relative to bucket.
+func (s *Signer) Once(appID, bucket, file string, creds *Credentials) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sign(appID, bucket, "/"+appID+"/"+bucket+file, creds, s.now(), 0)
+}
+
+// File returns a signature valid for any number of requests on file until expire; it is not
+// cached.
+func (s *Signer) File(appID, bucket, file string, creds *Credentials, expire time.Time) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sign(appID, bucket, "/"+appID+"/"+bucket+file, creds, s.now(), expire.Unix())
+}
+
+// Request returns the Authorization of request for the XML API, a key-time signature valid
+// until expire over the method, the path, the query parameters, the host and the x-cos-*
+// headers of request.
+func (s *Signer) Request(request *http.Request, creds *Credentials, expire time.Time) string {
+	var b strings.Builder
+	for i, field := range s.keyTimeFields(request, creds, expire) {
+		if i > 0 {
+			b.WriteString("&")
+		}
+		b.WriteString(field[0] + "=" + field[1])
+	}
+	return b.String()
+}
+
+// requestQuery is the signature of Request as query parameters, for presigned URLs.
+func (s *Signer) requestQuery(request *http.Request, creds *Credentials, expire time.Time) string {
+	var b strings.Builder
+	for i, field := range s.keyTimeFields(request, creds, expire) {
+		if i > 0 {
+			b.WriteString("&")
+		}
+		b.WriteString(field[0] + "=" + url.QueryEscape(field[1]))
+	}
+	return b.String()
+}
+
+func (s *Signer) keyTimeFields(request *http.Request, creds *Credentials, expire time.Time) [][2]string {
+	keyTime := fmt.Sprintf("%d;%d", s.now().Unix(), expire.Unix())
+
+	headers := map[string][]string{"host": {request.URL.Host}}
+	for key, values := range request.Header {
+		key = strings.ToLower(key)
+		if strings.HasPrefix(key, "x-cos-") && key != SECURITY_TOKEN_HEADER {
+			headers[key] = values
+		}
+	}
+	headerList, headerString := canonicalValues(headers)
+	paramList, paramString := canonicalValues(request.URL.Query())
+
+	httpString := strings.ToLower(request.Method) + "\n" + request.URL.Path + "\n" + paramString + "\n" + headerString + "\n"
+	httpSum := sha1.Sum([]byte(httpString))
+	stringToSign := "sha1\n" + keyTime + "\n" + hex.EncodeToString(httpSum[:]) + "\n"
+
+	signKey := hmac.New(sha1.New, []byte(creds.SecretKey))
+	signKey.Write([]byte(keyTime))
+	signature := hmac.New(sha1.New, []byte(hex.EncodeToString(signKey.Sum(nil))))
+	signature.Write([]byte(stringToSign))
+
+	return [][2]string{
+		{"q-sign-algorithm", "sha1"},
+		{"q-ak", creds.SecretID},
+		{"q-sign-time", keyTime},
+		{"q-key-time", keyTime},
+		{"q-header-list", headerList},
+		{"q-url-param-list", paramList},
+		{"q-signature", hex.EncodeToString(signature.Sum(nil))},
+	}
+}
+
+// canonicalValues returns the lower-cased sorted keys of values joined by ";", and the
+// key=value pairs in that order joined by "&", with the values URL-encoded.
+func canonicalValues(values map[string][]string) (string, string) {
+	keys := make([]string, 0, len(values))
+	lower := map[string]string{}
+	for key, v := range values {
+		k := strings.ToLower(key)
+		keys = append(keys, k)
+		if len(v) > 0 {
+			lower[k] = v[0]
+		}
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = url.QueryEscape(key) + "=" + strings.ReplaceAll(url.QueryEscape(lower[key]), "+", "%20")
+	}
+	return strings.Join(keys, ";"), strings.Join(pairs, "&")
+}
+
+// sign signs the plain text of the fields with the SecretKey of creds. The caller must hold mu.
+func (s *Signer) sign(appID, bucket, file string, creds *Credentials, now time.Time, expire int64) string {
+	if s.random == nil {
+		source := s.Rand
+		if source == nil {
+			source = rand.NewSource(time.Now().UnixNano())
+		}
+		s.random = rand.New(source)
+	}
+	plain := fmt.Sprintf("a=%s&b=%s&k=%s&e=%d&t=%d&r=%d&f=%s",
+		appID, bucket, creds.SecretID, expire, now.Unix(), s.random.Int63n(9000000000)+1000000000, file)
+
+	hash := hmac.New(sha1.New, []byte(creds.SecretKey))
+	hash.Write([]byte(plain))
+	return base64.StdEncoding.EncodeToString(append(hash.Sum(nil), plain...))
+}
+
+func (s *Signer) now() time.Time {
+	if s.Now == nil {
+		return time.Now()
+	}
+	return s.Now()
+}
+
+// signer returns the Signer of the client, creating one when none is set.
+func (c *CosClient) signer() *Signer {
+	c.signerOnce.Do(func() {
+		if c.Signer == nil {
+			c.Signer = &Signer{}
+		}
+	})
+	return c.Signer
+}
+
+// PresignGet returns a URL anyone can download remote with until ttl passes, signed for
+// remote alone. ttl must not exceed MULTI_SIGNATURE_TTL nor outlast temporary credentials.
+func (c *CosClient) PresignGet(remote string, ttl time.Duration) (string, error) {
+	return c.PresignGetContext(context.Background(), remote, ttl)
+}
+
+func (c *CosClient) PresignGetContext(ctx context.Context, remote string, ttl time.Duration) (string, error) {
+	if strings.HasSuffix(remote, "/") {
+		return "", ErrIsDirectory
+	}
+	if ttl <= 0 || ttl > MULTI_SIGNATURE_TTL {
+		return "", fmt.Errorf("presign %s: ttl must be between 0 and %s", remote, MULTI_SIGNATURE_TTL)
+	}
+	creds, err := c.credentials(ctx)
+	if err != nil {
+		return "", err
+	}
+	expire := c.signer().now().Add(ttl)
+	if !creds.Expiration.IsZero() && creds.Expiration.Before(expire) {
+		return "", fmt.Errorf("presign %s: credentials expire at %s, before the link would", remote, creds.Expiration.Format(time.RFC3339))
+	}
+	if !strings.HasPrefix(remote, "/") {
+		remote = "/" + remote
+	}
+	return c.protocol().presign(remote, creds, expire), nil
+}
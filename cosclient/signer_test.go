@@ -0,0 +1,117 @@
+package cosclient_test
+
+import (
+	"encoding/base64"
+	"gocos/cosclient"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// plain returns the signed plain text of a signature, which follows the 20-byte HMAC-SHA1.
+func plain(t *testing.T, signature string) string {
+	decoded, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || len(decoded) < 20 {
+		t.Fatalf("signature %q: %v", signature, err)
+	}
+	return string(decoded[20:])
+}
+
+func TestMultiSignature(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	signer := &cosclient.Signer{Now: func() time.Time { return now }, Rand: rand.NewSource(1)}
+	creds := &cosclient.Credentials{SecretID: "id", SecretKey: "key"}
+
+	a := signer.Multi("1250000000", "a", creds)
+	b := signer.Multi("1250000000", "b", creds)
+	if !strings.Contains(plain(t, a), "&b=a&") || !strings.Contains(plain(t, b), "&b=b&") {
+		t.Errorf("signatures of buckets a and b sign %q and %q", plain(t, a), plain(t, b))
+	}
+	if again := signer.Multi("1250000000", "a", creds); again != a {
+		t.Errorf("second signature of bucket a is %q, expected the cached %q", plain(t, again), plain(t, a))
+	}
+
+	now = now.Add(cosclient.MULTI_SIGNATURE_TTL - cosclient.SIGNATURE_REFRESH_WINDOW - time.Minute)
+	if again := signer.Multi("1250000000", "a", creds); again != a {
+		t.Errorf("signature of bucket a was replaced %s before it expires", cosclient.SIGNATURE_REFRESH_WINDOW+time.Minute)
+	}
+	now = now.Add(2 * time.Minute)
+	refreshed := signer.Multi("1250000000", "a", creds)
+	if refreshed == a {
+		t.Errorf("signature of bucket a was not replaced %s before it expires", cosclient.SIGNATURE_REFRESH_WINDOW-time.Minute)
+	}
+	if expected := now.Add(cosclient.MULTI_SIGNATURE_TTL).Unix(); !strings.Contains(plain(t, refreshed), "&e="+strconv.FormatInt(expected, 10)+"&") {
+		t.Errorf("replaced signature signs %q, expected it to expire at %d", plain(t, refreshed), expected)
+	}
+
+	rotated := &cosclient.Credentials{SecretID: "id2", SecretKey: "key2"}
+	if signature := signer.Multi("1250000000", "a", rotated); !strings.Contains(plain(t, signature), "&k=id2&") {
+		t.Errorf("signature after rotating the credentials signs %q", plain(t, signature))
+	}
+	if signature := signer.Multi("1250000000", "a", creds); signature == refreshed {
+		t.Error("signature of the rotated-out credentials was still cached")
+	}
+
+	temporary := &cosclient.Credentials{SecretID: "id", SecretKey: "key", SessionToken: "token", Expiration: now.Add(30 * time.Minute)}
+	first := signer.Multi("1250000000", "c", temporary)
+	if !strings.Contains(plain(t, first), "&e="+strconv.FormatInt(temporary.Expiration.Unix(), 10)+"&") {
+		t.Errorf("signature of temporary credentials signs %q, expected it to expire with them", plain(t, first))
+	}
+	now = now.Add(20 * time.Minute)
+	if signature := signer.Multi("1250000000", "c", temporary); signature != first {
+		t.Error("signature of temporary credentials was replaced 10m before it expires")
+	}
+	now = now.Add(5 * time.Minute)
+	if signature := signer.Multi("1250000000", "c", temporary); signature == first {
+		t.Error("signature of temporary credentials was not replaced 5m before it expires")
+	}
+}
+
+// TestRequestSignature signs the requests of the example in the XML API's signature docs,
+// with the example's keys and key time. Only the host and x-cos-* headers are signed, so the
+// expected signatures follow the documented steps over those headers.
+func TestRequestSignature(t *testing.T) {
+	creds := &cosclient.Credentials{SecretID: "AKIDQjz3ltompVjBni5LitkWHFlFpwkn9U5q", SecretKey: "BQYIM75p8x0iWVFSIgqEKwFprpRSVHlz"}
+	host := "https://examplebucket-1250000000.cos.ap-beijing.myqcloud.com"
+	for _, c := range []struct {
+		method, url   string
+		header        map[string]string
+		start, expire int64
+		expected      string
+	}{
+		{
+			"PUT", host + "/exampleobject(%E8%85%BE%E8%AE%AF%E4%BA%91)",
+			map[string]string{
+				"Content-Type":         "text/plain",
+				"X-Cos-Acl":            "private",
+				"X-Cos-Grant-Read":     `uin="100000000011"`,
+				"X-Cos-Security-Token": "token",
+			},
+			1557989151, 1557996351,
+			"q-sign-algorithm=sha1&q-ak=AKIDQjz3ltompVjBni5LitkWHFlFpwkn9U5q&q-sign-time=1557989151;1557996351&q-key-time=1557989151;1557996351" +
+				"&q-header-list=host;x-cos-acl;x-cos-grant-read&q-url-param-list=&q-signature=033f6b2e60c4f7a2f1626a9bd438519440b52e3c",
+		},
+		{
+			"GET", host + "/exampleobject(%E8%85%BE%E8%AE%AF%E4%BA%91)?response-content-type=application%2Foctet-stream&response-cache-control=max-age%3D600",
+			nil,
+			1557989753, 1557996953,
+			"q-sign-algorithm=sha1&q-ak=AKIDQjz3ltompVjBni5LitkWHFlFpwkn9U5q&q-sign-time=1557989753;1557996953&q-key-time=1557989753;1557996953" +
+				"&q-header-list=host&q-url-param-list=response-cache-control;response-content-type&q-signature=cf18ded2f669fcafa4b98e02c2a3fdb2b2e55c43",
+		},
+	} {
+		request, err := http.NewRequest(c.method, c.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for key, value := range c.header {
+			request.Header.Set(key, value)
+		}
+		signer := &cosclient.Signer{Now: func() time.Time { return time.Unix(c.start, 0) }}
+		if authorization := signer.Request(request, creds, time.Unix(c.expire, 0)); authorization != c.expected {
+			t.Errorf("%s %s: Authorization is\n%s\nexpected\n%s", c.method, c.url, authorization, c.expected)
+		}
+	}
+}
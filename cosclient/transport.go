@@ -0,0 +1,258 @@
+package cosclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+// TLS_VERSIONS are the values of TLSMinVersion.
+var TLS_VERSIONS = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Middleware wraps the transport requests are sent with, to log, measure, retry or
+// decorate them.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc is an http.RoundTripper calling itself.
+type RoundTripperFunc func(request *http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(request *http.Request) (*http.Response, error) {
+	return f(request)
+}
+
+// client returns the http.Client of the requests, built on first use.
+func (c *CosClient) client() (*http.Client, error) {
+	c.httpOnce.Do(func() {
+		c.httpClient, c.httpErr = c.buildClient()
+	})
+	return c.httpClient, c.httpErr
+}
+
+func (c *CosClient) buildClient() (*http.Client, error) {
+	client := &http.Client{}
+	var transport http.RoundTripper
+	if c.HTTPClient != nil {
+		*client = *c.HTTPClient
+		transport = client.Transport
+	} else if c.Transport != nil {
+		transport = c.Transport
+	} else {
+		t, err := c.newTransport()
+		if err != nil {
+			return nil, err
+		}
+		transport = t
+		if c.ReadTimeout > 0 {
+			transport = readTimeout(time.Duration(c.ReadTimeout))(transport)
+		}
+	}
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	for i := len(c.Middleware) - 1; i >= 0; i-- {
+		transport = c.Middleware[i](transport)
+	}
+	client.Transport = transport
+	return client, nil
+}
+
+// newTransport returns a transport with the timeouts, proxy and TLS settings of the client.
+func (c *CosClient) newTransport() (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	dialer := &net.Dialer{Timeout: time.Duration(c.ConnectTimeout), KeepAlive: 30 * time.Second}
+	transport.DialContext = dialer.DialContext
+	if c.ConnectTimeout > 0 {
+		transport.TLSHandshakeTimeout = time.Duration(c.ConnectTimeout)
+	}
+	transport.ResponseHeaderTimeout = time.Duration(c.ReadTimeout)
+
+	if c.Proxy != "" {
+		proxy, err := url.Parse(c.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("Proxy: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	if c.CAFile == "" && c.TLSMinVersion == "" {
+		return transport, nil
+	}
+	config := &tls.Config{}
+	if c.CAFile != "" {
+		pem, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("CAFile: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CAFile: no certificate found in %s", c.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	if c.TLSMinVersion != "" {
+		version, ok := TLS_VERSIONS[c.TLSMinVersion]
+		if !ok {
+			return nil, fmt.Errorf("TLSMinVersion: unknown version %q, expected 1.0, 1.1, 1.2 or 1.3", c.TLSMinVersion)
+		}
+		config.MinVersion = version
+	}
+	transport.TLSClientConfig = config
+	return transport, nil
+}
+
+// readTimeout fails a read of a response body that gets no data for timeout, so a stalled
+// download errors out instead of hanging once the headers arrived.
+func readTimeout(timeout time.Duration) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(request *http.Request) (*http.Response, error) {
+			response, err := next.RoundTrip(request)
+			if err == nil {
+				response.Body = newIdleBody(response.Body, timeout)
+			}
+			return response, err
+		})
+	}
+}
+
+// ErrReadTimeout is returned when no data of a response body arrives for ReadTimeout. It is
+// a net.Error timing out, so the read is retried like other transport errors.
+var ErrReadTimeout error = readTimeoutError{}
+
+type readTimeoutError struct{}
+
+func (readTimeoutError) Error() string   { return "response body read timeout" }
+func (readTimeoutError) Timeout() bool   { return true }
+func (readTimeoutError) Temporary() bool { return true }
+
+// idleBody closes body when a Read waits longer than timeout, which fails that Read. The
+// time between reads, while the caller is busy, does not count.
+type idleBody struct {
+	body    io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+	expired int32
+}
+
+func newIdleBody(body io.ReadCloser, timeout time.Duration) *idleBody {
+	b := &idleBody{body: body, timeout: timeout}
+	b.timer = time.AfterFunc(timeout, func() {
+		atomic.StoreInt32(&b.expired, 1)
+		body.Close()
+	})
+	b.timer.Stop()
+	return b
+}
+
+func (b *idleBody) Read(p []byte) (int, error) {
+	if atomic.LoadInt32(&b.expired) == 1 {
+		return 0, ErrReadTimeout
+	}
+	b.timer.Reset(b.timeout)
+	n, err := b.body.Read(p)
+	if !b.timer.Stop() && atomic.LoadInt32(&b.expired) == 1 {
+		return n, ErrReadTimeout
+	}
+	return n, err
+}
+
+func (b *idleBody) Close() error {
+	b.timer.Stop()
+	return b.body.Close()
+}
+
+// LogRequests logs every request with its status and duration through logf, log.Printf
+// for instance. Query strings are left out as they may carry signatures.
+func LogRequests(logf func(format string, args ...interface{})) Middleware {
+	return ObserveRequests(func(request *http.Request, response *http.Response, err error, duration time.Duration) {
+		status := ""
+		if err != nil {
+			status = err.Error()
+		} else {
+			status = response.Status
+		}
+		logf("%s %s://%s%s %s %s", request.Method, request.URL.Scheme, request.URL.Host, request.URL.Path, status, duration.Round(time.Millisecond))
+	})
+}
+
+// ObserveRequests calls observe once every request is answered or failed, to record
+// metrics for instance. The response body is not read yet.
+func ObserveRequests(observe func(request *http.Request, response *http.Response, err error, duration time.Duration)) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(request *http.Request) (*http.Response, error) {
+			start := time.Now()
+			response, err := next.RoundTrip(request)
+			observe(request, response, err, time.Since(start))
+			return response, err
+		})
+	}
+}
+
+// SetHeader sets the header key to value on every request.
+func SetHeader(key, value string) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(request *http.Request) (*http.Response, error) {
+			request = request.Clone(request.Context())
+			request.Header.Set(key, value)
+			return next.RoundTrip(request)
+		})
+	}
+}
+
+// RetryRequests tries requests again on transport errors and 429 or 5xx responses as policy
+// allows. CosClient already retries whole operations with Retry; this is for transports
+// shared with other code or retries below the other middleware.
+func RetryRequests(policy RetryPolicy) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(request *http.Request) (*http.Response, error) {
+			for attempt := 1; ; attempt++ {
+				response, err := next.RoundTrip(request)
+				failure := err
+				if err == nil && (response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500) {
+					failure = &StatusError{response.StatusCode, response.Status}
+				}
+				if failure == nil || attempt >= policy.MaxAttempts || !policy.retryable(failure) {
+					return response, err
+				}
+				retry, rewindErr := rewind(request)
+				if rewindErr != nil {
+					return response, err
+				}
+				if response != nil {
+					response.Body.Close()
+				}
+				if !sleep(request.Context(), policy.backoff(attempt)) {
+					return nil, request.Context().Err()
+				}
+				request = retry
+			}
+		})
+	}
+}
+
+// sleep waits for d and reports whether ctx was still alive afterwards.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
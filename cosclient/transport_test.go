@@ -0,0 +1,162 @@
+package cosclient_test
+
+import (
+	"encoding/pem"
+	"errors"
+	"gocos/cosclient"
+	"gocos/cosfake"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMiddleware(t *testing.T) {
+	server := cosfake.New()
+	defer server.Close()
+	server.Put("/a.txt", []byte("a"))
+
+	var calls []string
+	record := func(name string) cosclient.Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return cosclient.RoundTripperFunc(func(request *http.Request) (*http.Response, error) {
+				calls = append(calls, name+" "+request.Header.Get("X-Test"))
+				return next.RoundTrip(request)
+			})
+		}
+	}
+	var logged []string
+	client := server.Client()
+	client.Middleware = []cosclient.Middleware{
+		record("outer"),
+		cosclient.SetHeader("X-Test", "injected"),
+		record("inner"),
+		cosclient.LogRequests(func(format string, args ...interface{}) {
+			logged = append(logged, format)
+		}),
+	}
+
+	if _, err := client.List("/"); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"outer ", "inner injected"}; !reflect.DeepEqual(calls, expected) {
+		t.Errorf("middleware called as %v, expected %v", calls, expected)
+	}
+	if len(logged) != 1 {
+		t.Errorf("%d requests logged, expected 1", len(logged))
+	}
+}
+
+func TestRetryRequests(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	policy := cosclient.RetryPolicy{MaxAttempts: 3, InitialBackoff: cosclient.Duration(time.Millisecond)}
+	client := &http.Client{Transport: cosclient.RetryRequests(policy)(http.DefaultTransport)}
+	resp, err := client.Post(server.URL, "text/plain", strings.NewReader("body"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !reflect.DeepEqual(bodies, []string{"body", "body", "body"}) {
+		t.Errorf("got %s after requests with bodies %q", resp.Status, bodies)
+	}
+}
+
+func TestTLSSettings(t *testing.T) {
+	server := cosfake.NewTLS()
+	defer server.Close()
+
+	client := server.Client()
+	if _, err := client.List("/"); err == nil {
+		t.Error("certificate of the fake trusted without CAFile")
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, certificate, 0644); err != nil {
+		t.Fatal(err)
+	}
+	client = server.Client()
+	client.CAFile = caFile
+	client.TLSMinVersion = "1.2"
+	client.ConnectTimeout = cosclient.Duration(5 * time.Second)
+	client.ReadTimeout = cosclient.Duration(5 * time.Second)
+	if _, err := client.List("/"); err != nil {
+		t.Errorf("List with CAFile: %s", err)
+	}
+
+	client = server.Client()
+	client.TLSMinVersion = "1.9"
+	client.Retry = &cosclient.RetryPolicy{MaxAttempts: 3}
+	retries := 0
+	client.OnRetry = func(string, int, error) { retries++ }
+	if _, err := client.List("/"); err == nil || !strings.Contains(err.Error(), "TLSMinVersion") {
+		t.Errorf("List with an unknown TLSMinVersion: %v", err)
+	}
+	if retries != 0 {
+		t.Errorf("invalid TLSMinVersion retried %d times", retries)
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	stalled := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 5; i++ {
+			w.Write([]byte("x"))
+			w.(http.Flusher).Flush()
+			time.Sleep(20 * time.Millisecond)
+		}
+		if strings.HasSuffix(r.URL.Path, "/stalled.txt") {
+			select {
+			case <-stalled:
+			case <-r.Context().Done():
+			}
+		}
+	}))
+	defer server.Close()
+	defer close(stalled)
+
+	client := &cosclient.CosClient{
+		AppID:       "1250000000",
+		SecretID:    "id",
+		SecretKey:   "key",
+		Bucket:      "fake",
+		Endpoint:    server.URL,
+		PathStyle:   true,
+		ReadTimeout: cosclient.Duration(200 * time.Millisecond),
+		Retry:       &cosclient.RetryPolicy{MaxAttempts: 1},
+	}
+	var body []byte
+	err := client.DownloadStream("/slow.txt", func(r io.Reader) (err error) {
+		body, err = ioutil.ReadAll(r)
+		return err
+	})
+	if err != nil || string(body) != "xxxxx" {
+		t.Errorf("slow download read %q: %v", body, err)
+	}
+
+	start := time.Now()
+	err = client.DownloadStream("/stalled.txt", func(r io.Reader) (err error) {
+		body, err = ioutil.ReadAll(r)
+		return err
+	})
+	if !errors.Is(err, cosclient.ErrReadTimeout) || string(body) != "xxxxx" {
+		t.Errorf("stalled download read %q: %v", body, err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("stalled download failed after %s", elapsed)
+	}
+}
@@ -0,0 +1,40 @@
+package cosclient
+
+import (
+	"context"
+	"errors"
+)
+
+// SkipDir returned by a Walk function skips the directory it was called for; for a file
+// it is the same as returning nil.
+var SkipDir = errors.New("skip this directory")
+
+// Walk calls fn for every resource below dir, which must end with "/", descending into
+// subdirectories after fn has seen them. Directory paths end with "/". An error from fn
+// other than SkipDir stops the walk.
+func (c *CosClient) Walk(dir string, fn func(path string, resource CosResource) error) error {
+	return c.WalkContext(context.Background(), dir, fn)
+}
+
+func (c *CosClient) WalkContext(ctx context.Context, dir string, fn func(path string, resource CosResource) error) error {
+	resources, err := c.ListContext(ctx, dir)
+	if err != nil {
+		return err
+	}
+	for _, resource := range resources {
+		path := dir + resource.Name
+		err := fn(path, resource)
+		if err == SkipDir {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if resource.IsDir() {
+			if err := c.WalkContext(ctx, path, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,378 @@
+package cosclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// XML_SIGNATURE_TTL is how long the signature of an XML API request stays valid, long
+// enough to cover its retries.
+const XML_SIGNATURE_TTL = time.Hour
+
+// XML_REGIONS maps the short regions of the JSON API to the regions of the XML API.
+var XML_REGIONS = map[string]string{
+	"gz":  "ap-guangzhou",
+	"sh":  "ap-shanghai",
+	"tj":  "ap-beijing-1",
+	"bj":  "ap-beijing",
+	"cd":  "ap-chengdu",
+	"cq":  "ap-chongqing",
+	"hk":  "ap-hongkong",
+	"sgp": "ap-singapore",
+	"ca":  "na-toronto",
+	"ger": "eu-frankfurt",
+}
+
+// XML_ACLS maps the authorities of the JSON API to the canned ACLs of the XML API.
+var XML_ACLS = map[string]string{
+	"eInvalid":         "default",
+	"eWRPrivate":       "private",
+	"eWPrivateRPublic": "public-read",
+}
+
+// xmlAPI is the XML API of <bucket>-<appid>.cos.<region>.myqcloud.com, signed with HMAC-SHA1
+// key-time signatures. Directories are the common prefixes of keys, and slice uploads are
+// multipart uploads whose upload id is the session.
+type xmlAPI struct {
+	c *CosClient
+}
+
+type xmlObject struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int64
+}
+
+type xmlPart struct {
+	PartNumber int
+	ETag       string
+	Size       int64 `xml:",omitempty"`
+}
+
+// objectURL returns the URL of the object at path, which starts with "/" like the paths of
+// the JSON API.
+func (a *xmlAPI) objectURL(path string, query url.Values) string {
+	endpoint := a.c.Endpoint
+	if endpoint == "" {
+		region := a.c.Local
+		if r, ok := XML_REGIONS[region]; ok {
+			region = r
+		}
+		endpoint = "cos." + region + ".myqcloud.com"
+	}
+	return a.join(a.c.bucketURL(endpoint), path, query)
+}
+
+// join appends path and query to base.
+func (a *xmlAPI) join(base, path string, query url.Values) string {
+	u, err := url.Parse(base)
+	if err != nil {
+		return base + path
+	}
+	u.Path += "/" + strings.TrimPrefix(path, "/")
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func (a *xmlAPI) authorize(request *http.Request, creds *Credentials, file string) {
+	request.Header.Set("Authorization", a.c.signer().Request(request, creds, a.expire(creds, XML_SIGNATURE_TTL)))
+}
+
+// expire returns when a signature made now for ttl expires, no later than creds.
+func (a *xmlAPI) expire(creds *Credentials, ttl time.Duration) time.Time {
+	expire := a.c.signer().now().Add(ttl)
+	if !creds.Expiration.IsZero() && creds.Expiration.Before(expire) {
+		expire = creds.Expiration
+	}
+	return expire
+}
+
+// do sends a signed request and decodes the XML body of a successful response into val when
+// it is not nil. Failures are a *StatusError wrapped with the error code cos sent.
+func (a *xmlAPI) do(ctx context.Context, method, target string, body []byte, header http.Header, val interface{}) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	if err := a.c.authorize(request, ""); err != nil {
+		return nil, err
+	}
+	resp, err := a.c.doRequest(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		statusErr := &StatusError{resp.StatusCode, resp.Status}
+		var e struct {
+			Code    string
+			Message string
+		}
+		if xml.NewDecoder(resp.Body).Decode(&e) != nil || e.Code == "" {
+			return resp, statusErr
+		}
+		return resp, fmt.Errorf("%s %s: %w", e.Code, e.Message, statusErr)
+	}
+	if val != nil {
+		if err := xml.NewDecoder(resp.Body).Decode(val); err != nil {
+			return resp, err
+		}
+	}
+	return resp, nil
+}
+
+func (a *xmlAPI) list(ctx context.Context, path string, listContext string) (*ListResponse, error) {
+	prefix := strings.TrimPrefix(path, "/")
+	query := url.Values{"prefix": {prefix}, "delimiter": {"/"}, "max-keys": {"1000"}}
+	if listContext != "" {
+		query.Set("marker", listContext)
+	}
+
+	var result struct {
+		IsTruncated    bool
+		NextMarker     string
+		Contents       []xmlObject
+		CommonPrefixes []struct {
+			Prefix string
+		}
+	}
+	if _, err := a.do(ctx, "GET", a.objectURL("/", query), nil, nil, &result); err != nil {
+		return nil, err
+	}
+
+	response := &ListResponse{}
+	response.Data.Listover = !result.IsTruncated
+	response.Data.Context = result.NextMarker
+	for _, p := range result.CommonPrefixes {
+		response.Data.Infos = append(response.Data.Infos, CosResource{Name: p.Prefix[len(prefix):]})
+	}
+	for _, object := range result.Contents {
+		if object.Key == prefix {
+			// the placeholder object of the directory itself
+			continue
+		}
+		mtime, _ := time.Parse(time.RFC3339, object.LastModified)
+		response.Data.Infos = append(response.Data.Infos, CosResource{
+			Name:      object.Key[len(prefix):],
+			FileSize:  object.Size,
+			FileLen:   object.Size,
+			Mtime:     mtime.Unix(),
+			Ctime:     mtime.Unix(),
+			AccessUrl: a.objectURL("/"+object.Key, nil),
+		})
+	}
+	if response.Data.Context == "" && result.IsTruncated {
+		// without NextMarker the listing continues after the last key or prefix returned
+		if n := len(result.Contents); n > 0 {
+			response.Data.Context = result.Contents[n-1].Key
+		}
+		if n := len(result.CommonPrefixes); n > 0 && result.CommonPrefixes[n-1].Prefix > response.Data.Context {
+			response.Data.Context = result.CommonPrefixes[n-1].Prefix
+		}
+	}
+	return response, nil
+}
+
+func (a *xmlAPI) stat(ctx context.Context, path string) (*StatFileResult, error) {
+	if strings.HasSuffix(path, "/") {
+		// a directory exists as long as some key starts with it
+		var result struct {
+			Contents       []xmlObject
+			CommonPrefixes []struct{ Prefix string }
+		}
+		query := url.Values{"prefix": {strings.TrimPrefix(path, "/")}, "max-keys": {"1"}}
+		if _, err := a.do(ctx, "GET", a.objectURL("/", query), nil, nil, &result); err != nil {
+			return nil, err
+		}
+		if len(result.Contents) == 0 && path != "/" {
+			return nil, &StatusError{http.StatusNotFound, "404 Not Found"}
+		}
+		return &StatFileResult{}, nil
+	}
+
+	resp, err := a.do(ctx, "HEAD", a.objectURL(path, nil), nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	mtime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return &StatFileResult{
+		AccessUrl: a.objectURL(path, nil),
+		FileSize:  resp.ContentLength,
+		FileLen:   resp.ContentLength,
+		Ctime:     mtime.Unix(),
+		Mtime:     mtime.Unix(),
+		Sha:       resp.Header.Get("x-cos-meta-sha1"),
+	}, nil
+}
+
+// checkCover returns ErrExists when remote exists and may not be overwritten; the XML API
+// always overwrites.
+func (a *xmlAPI) checkCover(ctx context.Context, remote string, cover bool) error {
+	if cover {
+		return nil
+	}
+	_, err := a.stat(ctx, remote)
+	if err == nil {
+		return ErrExists
+	}
+	if IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (a *xmlAPI) putObject(ctx context.Context, content []byte, remote string, cover bool) error {
+	if err := a.checkCover(ctx, remote, cover); err != nil {
+		return err
+	}
+	sum := sha1.Sum(content)
+	header := http.Header{"X-Cos-Meta-Sha1": {hex.EncodeToString(sum[:])}}
+	_, err := a.do(ctx, "PUT", a.objectURL(remote, nil), content, header, nil)
+	return err
+}
+
+func (a *xmlAPI) initSlices(ctx context.Context, remote string, size, sliceSize int64, sha string, parts []slicePart, cover bool) (string, error) {
+	if err := a.checkCover(ctx, remote, cover); err != nil {
+		return "", err
+	}
+	var result struct {
+		UploadId string
+	}
+	header := http.Header{"X-Cos-Meta-Sha1": {sha}}
+	if _, err := a.do(ctx, "POST", a.objectURL(remote, url.Values{"uploads": {""}}), nil, header, &result); err != nil {
+		return "", err
+	}
+	return result.UploadId, nil
+}
+
+// parts returns every part of the multipart upload uploadId to remote.
+func (a *xmlAPI) parts(ctx context.Context, remote, uploadId string) ([]xmlPart, error) {
+	var parts []xmlPart
+	marker := ""
+	for {
+		query := url.Values{"uploadId": {uploadId}}
+		if marker != "" {
+			query.Set("part-number-marker", marker)
+		}
+		var result struct {
+			IsTruncated          bool
+			NextPartNumberMarker string
+			Part                 []xmlPart
+		}
+		if _, err := a.do(ctx, "GET", a.objectURL(remote, query), nil, nil, &result); err != nil {
+			return nil, err
+		}
+		parts = append(parts, result.Part...)
+		if !result.IsTruncated || result.NextPartNumberMarker == "" {
+			return parts, nil
+		}
+		marker = result.NextPartNumberMarker
+	}
+}
+
+// listSlices lists the parts of the upload; the service knows neither the file size nor the
+// slice size, which are taken from the checkpoint the upload id belongs to.
+func (a *xmlAPI) listSlices(ctx context.Context, remote string, cp *uploadCheckpoint) (*sliceList, error) {
+	parts, err := a.parts(ctx, remote, cp.Session)
+	if err != nil {
+		return nil, err
+	}
+	list := &sliceList{FileSize: cp.FileSize, Session: cp.Session, SliceSize: cp.SliceSize}
+	for _, part := range parts {
+		list.ListParts = append(list.ListParts, sliceListPart{int64(part.PartNumber-1) * cp.SliceSize, part.Size})
+	}
+	return list, nil
+}
+
+func (a *xmlAPI) uploadSlice(ctx context.Context, remote, session string, sliceSize, offset int64, b []byte) error {
+	query := url.Values{
+		"partNumber": {strconv.FormatInt(offset/sliceSize+1, 10)},
+		"uploadId":   {session},
+	}
+	_, err := a.do(ctx, "PUT", a.objectURL(remote, query), b, nil, nil)
+	return err
+}
+
+func (a *xmlAPI) finishSlices(ctx context.Context, remote, session string, size int64) error {
+	parts, err := a.parts(ctx, remote, session)
+	if err != nil {
+		return err
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+	complete := struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Part    []xmlPart
+	}{}
+	for _, part := range parts {
+		complete.Part = append(complete.Part, xmlPart{PartNumber: part.PartNumber, ETag: part.ETag})
+	}
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		return err
+	}
+	header := http.Header{"Content-Type": {"application/xml"}}
+	_, err = a.do(ctx, "POST", a.objectURL(remote, url.Values{"uploadId": {session}}), body, header, nil)
+	return err
+}
+
+func (a *xmlAPI) downloadURL(remote string) string {
+	if a.c.DownloadDomain != "" {
+		return a.join(a.c.baseURL(a.c.DownloadDomain), remote, nil)
+	}
+	return a.objectURL(remote, nil)
+}
+
+func (a *xmlAPI) delete(ctx context.Context, path string) error {
+	_, err := a.do(ctx, "DELETE", a.objectURL(path, nil), nil, nil, nil)
+	return err
+}
+
+// move copies src to target and deletes src, the XML API has no rename.
+func (a *xmlAPI) move(ctx context.Context, src, target string, force bool) error {
+	if err := a.checkCover(ctx, target, force); err != nil {
+		return err
+	}
+	source, err := url.Parse(a.objectURL(src, nil))
+	if err != nil {
+		return err
+	}
+	header := http.Header{"X-Cos-Copy-Source": {source.Host + source.EscapedPath()}}
+	if _, err := a.do(ctx, "PUT", a.objectURL(target, nil), nil, header, nil); err != nil {
+		return err
+	}
+	return a.delete(ctx, src)
+}
+
+func (a *xmlAPI) updateAuthority(ctx context.Context, remote, authority string) error {
+	acl, ok := XML_ACLS[authority]
+	if !ok {
+		return fmt.Errorf("unknown authority %s", authority)
+	}
+	header := http.Header{"X-Cos-Acl": {acl}}
+	_, err := a.do(ctx, "PUT", a.objectURL(remote, url.Values{"acl": {""}}), nil, header, nil)
+	return err
+}
+
+func (a *xmlAPI) presign(remote string, creds *Credentials, expire time.Time) string {
+	request, _ := http.NewRequest("GET", a.downloadURL(remote), nil)
+	query := a.c.signer().requestQuery(request, creds, expire)
+	if creds.SessionToken != "" {
+		query += "&" + SECURITY_TOKEN_HEADER + "=" + url.QueryEscape(creds.SessionToken)
+	}
+	return request.URL.String() + "?" + query
+}
@@ -0,0 +1,151 @@
+package cosclient
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// xmlServer serves handler as the bucket fake-1250000000 of an XML API client.
+func xmlServer(t *testing.T, handler http.HandlerFunc) *xmlAPI {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return &xmlAPI{&CosClient{
+		AppID:     "1250000000",
+		SecretID:  "id",
+		SecretKey: "key",
+		Bucket:    "fake",
+		Endpoint:  server.URL,
+		PathStyle: true,
+		API:       API_XML,
+		Retry:     &RetryPolicy{MaxAttempts: 1},
+	}}
+}
+
+func TestXMLList(t *testing.T) {
+	// pages by marker; the first sends NextMarker, the second leaves the client to continue
+	// after the last prefix
+	pages := map[string]string{
+		"": `<ListBucketResult><IsTruncated>true</IsTruncated><NextMarker>d/b.txt</NextMarker>
+			<Contents><Key>d/</Key><Size>0</Size></Contents>
+			<Contents><Key>d/a.txt</Key><Size>1</Size><LastModified>2020-01-01T00:00:00.000Z</LastModified></Contents>
+			<Contents><Key>d/b.txt</Key><Size>2</Size></Contents></ListBucketResult>`,
+		"d/b.txt": `<ListBucketResult><IsTruncated>true</IsTruncated>
+			<Contents><Key>d/c.txt</Key><Size>3</Size></Contents>
+			<CommonPrefixes><Prefix>d/sub/</Prefix></CommonPrefixes></ListBucketResult>`,
+		"d/sub/": `<ListBucketResult><IsTruncated>false</IsTruncated>
+			<Contents><Key>d/z.txt</Key><Size>4</Size></Contents></ListBucketResult>`,
+	}
+	a := xmlServer(t, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		page, ok := pages[query.Get("marker")]
+		if r.Method != "GET" || r.URL.Path != "/fake-1250000000/" || query.Get("prefix") != "d/" || query.Get("delimiter") != "/" || !ok {
+			http.Error(w, "unexpected request "+r.URL.String(), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, page)
+	})
+
+	var names []string
+	var contexts []string
+	listContext := ""
+	for {
+		response, err := a.list(context.Background(), "/d/", listContext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, info := range response.Data.Infos {
+			names = append(names, fmt.Sprintf("%s:%d", info.Name, info.FileSize))
+		}
+		if response.Data.Listover {
+			break
+		}
+		listContext = response.Data.Context
+		contexts = append(contexts, listContext)
+	}
+	if expected := []string{"a.txt:1", "b.txt:2", "sub/:0", "c.txt:3", "z.txt:4"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("listed %v, expected %v", names, expected)
+	}
+	if expected := []string{"d/b.txt", "d/sub/"}; !reflect.DeepEqual(contexts, expected) {
+		t.Errorf("listed with markers %v, expected %v", contexts, expected)
+	}
+}
+
+func TestXMLFinishSlices(t *testing.T) {
+	var completed []byte
+	a := xmlServer(t, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.URL.Path != "/fake-1250000000/big.bin" || query.Get("uploadId") != "upload" {
+			http.Error(w, "unexpected request "+r.URL.String(), http.StatusBadRequest)
+			return
+		}
+		switch {
+		case r.Method == "GET" && query.Get("part-number-marker") == "":
+			fmt.Fprint(w, `<ListPartsResult><IsTruncated>true</IsTruncated><NextPartNumberMarker>3</NextPartNumberMarker>
+				<Part><PartNumber>3</PartNumber><ETag>"c"</ETag><Size>1</Size></Part>
+				<Part><PartNumber>1</PartNumber><ETag>"a"</ETag><Size>2</Size></Part></ListPartsResult>`)
+		case r.Method == "GET" && query.Get("part-number-marker") == "3":
+			fmt.Fprint(w, `<ListPartsResult><IsTruncated>false</IsTruncated>
+				<Part><PartNumber>2</PartNumber><ETag>"b"</ETag><Size>2</Size></Part></ListPartsResult>`)
+		case r.Method == "POST" && r.Header.Get("Content-Type") == "application/xml":
+			completed, _ = ioutil.ReadAll(r.Body)
+			fmt.Fprint(w, `<CompleteMultipartUploadResult><Key>big.bin</Key></CompleteMultipartUploadResult>`)
+		default:
+			http.Error(w, "unexpected request "+r.Method+" "+r.URL.String(), http.StatusBadRequest)
+		}
+	})
+
+	if err := a.finishSlices(context.Background(), "/big.bin", "upload", 5); err != nil {
+		t.Fatal(err)
+	}
+	var complete struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Part    []xmlPart
+	}
+	if err := xml.Unmarshal(completed, &complete); err != nil {
+		t.Fatalf("completed with %q: %v", completed, err)
+	}
+	expected := []xmlPart{{PartNumber: 1, ETag: `"a"`}, {PartNumber: 2, ETag: `"b"`}, {PartNumber: 3, ETag: `"c"`}}
+	if !reflect.DeepEqual(complete.Part, expected) {
+		t.Errorf("completed with parts %+v, expected %+v", complete.Part, expected)
+	}
+}
+
+func TestFitSlices(t *testing.T) {
+	for _, c := range []struct {
+		api            string
+		partSize, size int64
+		expected       int64
+		err            string
+	}{
+		{API_XML, 0, 5 << 30, UPLOAD_SLICE_BLOCK_SIZE, ""},
+		{API_XML, 0, 10000 << 20, UPLOAD_SLICE_BLOCK_SIZE, ""},
+		{API_XML, 0, 10000<<20 + 1, 2 << 20, ""},
+		{API_XML, 0, 20 << 30, 3 << 20, ""},
+		{API_XML, 0, 60 << 40, 0, "exceed"},
+		{API_XML, 1 << 20, 20 << 30, 0, "UploadPartSize"},
+		{API_XML, 4 << 20, 20 << 30, 4 << 20, ""},
+		{API_JSON, 0, 20 << 30, UPLOAD_SLICE_BLOCK_SIZE, ""},
+	} {
+		client := &CosClient{API: c.api, UploadPartSize: c.partSize}
+		_, sliceSize, _, err := client.uploadParts()
+		if err == nil {
+			sliceSize, err = client.fitSlices(c.size, sliceSize)
+		}
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s API, part size %d, %d bytes: %v, expected a %s error", c.api, c.partSize, c.size, err, c.err)
+			}
+			continue
+		}
+		if err != nil || sliceSize != c.expected {
+			t.Errorf("%s API, part size %d, %d bytes: slices of %d, %v, expected %d", c.api, c.partSize, c.size, sliceSize, err, c.expected)
+		}
+	}
+}
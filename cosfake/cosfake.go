@@ -0,0 +1,694 @@
+// Package cosfake is an in-process fake of the cos files/v2 JSON API for hermetic tests.
+//
+// A Server keeps a bucket in memory and serves list, stat, upload, upload_slice_*,
+// delete, move and update under /files/v2/<AppID>/<Bucket>/, and ranged downloads at
+// /<Bucket>-<AppID>/ or on a <Bucket>-<AppID>. host. Requests must be signed with the
+// server's SecretID and SecretKey.
+//
+//	server := cosfake.New()
+//	defer server.Close()
+//	server.Put("/docs/a.txt", []byte("hello"))
+//	client := server.Client()
+package cosfake
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"gocos/cosclient"
+	"hash"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Error codes of the fake, as the service answers them.
+const (
+	CODE_OK            = 0
+	CODE_INVALID       = -1
+	CODE_SIGN_FAILED   = -62
+	CODE_DIR_NOT_EMPTY = -173
+	CODE_NOT_FOUND     = cosclient.CODE_NOT_FOUND
+	CODE_SHA_MISMATCH  = -288
+	CODE_NO_SESSION    = -4019
+	CODE_EXISTS        = -4018
+)
+
+// AUTHORITIES are the authorities a file can be updated to.
+var AUTHORITIES = []string{"eInvalid", "eWRPrivate", "eWPrivateRPublic"}
+
+// Server is a fake cos bucket. The exported fields may be changed before the first request.
+type Server struct {
+	*httptest.Server
+
+	AppID     string
+	Bucket    string
+	SecretID  string
+	SecretKey string
+	// PageSize caps the entries of one list page, the client's num when 0.
+	PageSize int
+	// SliceHook, if set, is called with every upload_slice_data request before its slice is
+	// stored; a non-nil error fails the slice.
+	SliceHook func(path string, offset int64) error
+
+	mu       sync.Mutex
+	files    map[string]*file
+	dirs     map[string]int64
+	sessions map[string]*session
+}
+
+type file struct {
+	data      []byte
+	sha       string
+	ctime     int64
+	mtime     int64
+	authority string
+}
+
+// session is an unfinished slice upload.
+type session struct {
+	id        string
+	path      string
+	size      int64
+	sliceSize int64
+	sha       string
+	parts     map[int64]string
+	cover     bool
+	slices    map[int64][]byte
+}
+
+// New starts a Server with an empty bucket; Close stops it.
+func New() *Server {
+	return start(httptest.NewServer)
+}
+
+// NewTLS is like New but serves HTTPS with the certificate returned by Certificate.
+func NewTLS() *Server {
+	return start(httptest.NewTLSServer)
+}
+
+func start(serve func(http.Handler) *httptest.Server) *Server {
+	s := &Server{
+		AppID:     "1250000000",
+		Bucket:    "fake",
+		SecretID:  "fake-secret-id",
+		SecretKey: "fake-secret-key",
+		files:     map[string]*file{},
+		dirs:      map[string]int64{"/": time.Now().Unix()},
+		sessions:  map[string]*session{},
+	}
+	s.Server = serve(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Client returns a client of the bucket, without retries so failures show at once.
+func (s *Server) Client() *cosclient.CosClient {
+	return &cosclient.CosClient{
+		AppID:     s.AppID,
+		SecretID:  s.SecretID,
+		SecretKey: s.SecretKey,
+		Bucket:    s.Bucket,
+		Endpoint:  s.URL,
+		PathStyle: true,
+		Retry:     &cosclient.RetryPolicy{MaxAttempts: 1},
+	}
+}
+
+// Put stores data at the file path, creating its parent directories.
+func (s *Server) Put(path string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.put(path, data)
+}
+
+// Mkdir creates the directory path, which ends with "/", and its parents.
+func (s *Server) Mkdir(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mkdirAll(path)
+}
+
+// Get returns the content of the file path.
+func (s *Server) Get(path string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.files[path]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), f.data...), true
+}
+
+// Authority returns the authority of the file path, "" when it does not exist.
+func (s *Server) Authority(path string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f, ok := s.files[path]; ok {
+		return f.authority
+	}
+	return ""
+}
+
+// ExpireSessions drops every unfinished slice upload, as the service does after a while.
+func (s *Server) ExpireSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions = map[string]*session{}
+}
+
+// Paths returns the paths of every file and directory but the root, sorted.
+func (s *Server) Paths() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	paths := []string{}
+	for p := range s.files {
+		paths = append(paths, p)
+	}
+	for p := range s.dirs {
+		if p != "/" {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	name := s.Bucket + "-" + s.AppID
+	api := "/files/v2/" + s.AppID + "/" + s.Bucket + "/"
+	switch {
+	case strings.HasPrefix(r.URL.Path, api):
+		s.serveAPI(w, r, r.URL.Path[len(api)-1:])
+	case strings.HasPrefix(r.Host, name+"."):
+		s.serveDownload(w, r, r.URL.Path)
+	case strings.HasPrefix(r.URL.Path, "/"+name+"/"):
+		s.serveDownload(w, r, r.URL.Path[len(name)+1:])
+	default:
+		reply(w, http.StatusNotFound, CODE_NOT_FOUND, "bucket not found", nil)
+	}
+}
+
+// reply writes the JSON response of the API.
+func reply(w http.ResponseWriter, status, code int, message string, data interface{}) {
+	if data == nil {
+		data = struct{}{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"code": code, "message": message, "data": data})
+}
+
+func (s *Server) serveAPI(w http.ResponseWriter, r *http.Request, p string) {
+	values, err := form(r)
+	if err != nil {
+		reply(w, http.StatusBadRequest, CODE_INVALID, err.Error(), nil)
+		return
+	}
+	op := values["op"]
+
+	file := ""
+	if op == "delete" || op == "move" {
+		// single-use signatures are bound to the file
+		file = p
+	}
+	if !s.authorized(r.Header.Get("Authorization"), file) {
+		reply(w, http.StatusForbidden, CODE_SIGN_FAILED, "sign check failed", nil)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch op {
+	case "list":
+		s.list(w, p, r.URL.Query())
+	case "stat":
+		s.stat(w, p)
+	case "upload":
+		s.upload(w, p, values)
+	case "upload_slice_init":
+		s.sliceInit(w, p, values)
+	case "upload_slice_data":
+		s.sliceData(w, p, values)
+	case "upload_slice_finish":
+		s.sliceFinish(w, p, values)
+	case "upload_slice_list":
+		s.sliceList(w, p)
+	case "delete":
+		s.delete(w, p)
+	case "move":
+		s.move(w, p, values)
+	case "update":
+		s.update(w, p, values)
+	default:
+		reply(w, http.StatusBadRequest, CODE_INVALID, "unknown op "+op, nil)
+	}
+}
+
+// form returns the parameters of r: the query of a GET, the multipart form or the JSON
+// object of a POST.
+func form(r *http.Request) (map[string]string, error) {
+	values := map[string]string{}
+	if r.Method == "GET" {
+		for key := range r.URL.Query() {
+			values[key] = r.URL.Query().Get(key)
+		}
+		return values, nil
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		err := json.NewDecoder(r.Body).Decode(&values)
+		return values, err
+	}
+	if err := r.ParseMultipartForm(64 << 20); err != nil {
+		return nil, err
+	}
+	for key := range r.MultipartForm.Value {
+		values[key] = r.MultipartForm.Value[key][0]
+	}
+	return values, nil
+}
+
+// authorized checks a signature of the bucket made with the server's keys. Single-use
+// signatures, and multi-use ones naming a file, must be for file.
+func (s *Server) authorized(sign, file string) bool {
+	raw, err := base64.StdEncoding.DecodeString(sign)
+	if err != nil || len(raw) <= sha1.Size {
+		return false
+	}
+	sum, plain := raw[:sha1.Size], raw[sha1.Size:]
+	mac := hmac.New(sha1.New, []byte(s.SecretKey))
+	mac.Write(plain)
+	if !hmac.Equal(sum, mac.Sum(nil)) {
+		return false
+	}
+
+	fields := map[string]string{}
+	// f is last and may contain "&"
+	for _, field := range strings.SplitN(string(plain), "&", 7) {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) == 2 {
+			fields[kv[0]] = kv[1]
+		}
+	}
+	if fields["a"] != s.AppID || fields["b"] != s.Bucket || fields["k"] != s.SecretID {
+		return false
+	}
+	expire, err := strconv.ParseInt(fields["e"], 10, 64)
+	if err != nil {
+		return false
+	}
+	resource := "/" + s.AppID + "/" + s.Bucket + file
+	if expire == 0 {
+		return file != "" && fields["f"] == resource
+	}
+	return expire > time.Now().Unix() && (fields["f"] == "" || fields["f"] == resource)
+}
+
+func (s *Server) list(w http.ResponseWriter, dir string, query map[string][]string) {
+	if _, ok := s.dirs[dir]; !ok {
+		reply(w, http.StatusNotFound, CODE_NOT_FOUND, "path not exist", nil)
+		return
+	}
+	infos := []cosclient.CosResource{}
+	for p, ctime := range s.dirs {
+		if p != dir && parent(p) == dir {
+			infos = append(infos, cosclient.CosResource{Name: p[len(dir):], Ctime: ctime, Mtime: ctime})
+		}
+	}
+	for p, f := range s.files {
+		if parent(p) == dir {
+			infos = append(infos, s.resource(p[len(dir):], f))
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+
+	context := ""
+	if values := query["context"]; len(values) > 0 {
+		context = values[0]
+	}
+	start := sort.Search(len(infos), func(i int) bool { return infos[i].Name > context })
+	infos = infos[start:]
+	num := 1000
+	if values := query["num"]; len(values) > 0 {
+		if n, err := strconv.Atoi(values[0]); err == nil && n > 0 {
+			num = n
+		}
+	}
+	if s.PageSize > 0 && s.PageSize < num {
+		num = s.PageSize
+	}
+	over := len(infos) <= num
+	if !over {
+		infos = infos[:num]
+		context = infos[num-1].Name
+	}
+	reply(w, http.StatusOK, CODE_OK, "SUCCESS", map[string]interface{}{"listover": over, "context": context, "infos": infos})
+}
+
+func (s *Server) resource(name string, f *file) cosclient.CosResource {
+	return cosclient.CosResource{
+		Name:      name,
+		FileSize:  int64(len(f.data)),
+		FileLen:   int64(len(f.data)),
+		Sha:       f.sha,
+		Ctime:     f.ctime,
+		Mtime:     f.mtime,
+		Authority: f.authority,
+	}
+}
+
+func (s *Server) stat(w http.ResponseWriter, p string) {
+	if ctime, ok := s.dirs[p]; ok {
+		reply(w, http.StatusOK, CODE_OK, "SUCCESS", cosclient.StatFileResult{Ctime: ctime, Mtime: ctime})
+		return
+	}
+	f, ok := s.files[p]
+	if !ok {
+		reply(w, http.StatusNotFound, CODE_NOT_FOUND, "path not exist", nil)
+		return
+	}
+	reply(w, http.StatusOK, CODE_OK, "SUCCESS", cosclient.StatFileResult{
+		AccessUrl:     s.URL + "/" + s.Bucket + "-" + s.AppID + p,
+		Authority:     f.authority,
+		Ctime:         f.ctime,
+		CustomHeaders: map[string]interface{}{},
+		FileLen:       int64(len(f.data)),
+		FileSize:      int64(len(f.data)),
+		Mtime:         f.mtime,
+		Sha:           f.sha,
+	})
+}
+
+// writable checks that a file may be stored at p, replying with the error if not.
+func (s *Server) writable(w http.ResponseWriter, p string, cover bool) bool {
+	if strings.HasSuffix(p, "/") {
+		reply(w, http.StatusBadRequest, CODE_INVALID, "path is a directory", nil)
+		return false
+	}
+	if _, ok := s.dirs[p+"/"]; ok {
+		reply(w, http.StatusBadRequest, CODE_INVALID, "a directory has the same name", nil)
+		return false
+	}
+	if _, ok := s.files[p]; ok && !cover {
+		reply(w, http.StatusConflict, CODE_EXISTS, "same name file exists", nil)
+		return false
+	}
+	return true
+}
+
+func (s *Server) upload(w http.ResponseWriter, p string, values map[string]string) {
+	if !s.writable(w, p, values["insertOnly"] == "0") {
+		return
+	}
+	data := []byte(values["filecontent"])
+	if sha := values["sha"]; sha != "" && !strings.EqualFold(sha, shaOf(data)) {
+		reply(w, http.StatusBadRequest, CODE_SHA_MISMATCH, "sha mismatch", nil)
+		return
+	}
+	s.put(p, data)
+	reply(w, http.StatusOK, CODE_OK, "SUCCESS", map[string]string{"access_url": s.URL + "/" + s.Bucket + "-" + s.AppID + p})
+}
+
+func (s *Server) sliceInit(w http.ResponseWriter, p string, values map[string]string) {
+	cover := values["insertOnly"] == "0"
+	if !s.writable(w, p, cover) {
+		return
+	}
+	size, err1 := strconv.ParseInt(values["filesize"], 10, 64)
+	sliceSize, err2 := strconv.ParseInt(values["slice_size"], 10, 64)
+	if err1 != nil || err2 != nil || size < 0 || sliceSize <= 0 {
+		reply(w, http.StatusBadRequest, CODE_INVALID, "invalid filesize or slice_size", nil)
+		return
+	}
+	var parts []struct {
+		Offset  int64  `json:"offset"`
+		DataSha string `json:"datasha"`
+	}
+	if values["uploadparts"] != "" {
+		if err := json.Unmarshal([]byte(values["uploadparts"]), &parts); err != nil {
+			reply(w, http.StatusBadRequest, CODE_INVALID, "invalid uploadparts", nil)
+			return
+		}
+	}
+
+	id := make([]byte, 16)
+	rand.Read(id)
+	sess := &session{
+		id:        hex.EncodeToString(id),
+		path:      p,
+		size:      size,
+		sliceSize: sliceSize,
+		sha:       values["sha"],
+		parts:     map[int64]string{},
+		cover:     cover,
+		slices:    map[int64][]byte{},
+	}
+	for _, part := range parts {
+		sess.parts[part.Offset] = part.DataSha
+	}
+	s.sessions[sess.id] = sess
+	reply(w, http.StatusOK, CODE_OK, "SUCCESS", map[string]interface{}{"session": sess.id, "slice_size": sliceSize})
+}
+
+func (s *Server) findSession(w http.ResponseWriter, p, id string) *session {
+	sess, ok := s.sessions[id]
+	if !ok || sess.path != p {
+		reply(w, http.StatusBadRequest, CODE_NO_SESSION, "session not exist", nil)
+		return nil
+	}
+	return sess
+}
+
+func (s *Server) sliceData(w http.ResponseWriter, p string, values map[string]string) {
+	sess := s.findSession(w, p, values["session"])
+	if sess == nil {
+		return
+	}
+	offset, err := strconv.ParseInt(values["offset"], 10, 64)
+	data := []byte(values["filecontent"])
+	if err != nil || offset < 0 || offset >= sess.size && sess.size > 0 || offset%sess.sliceSize != 0 ||
+		int64(len(data)) != sess.sliceSize && offset+int64(len(data)) != sess.size {
+		reply(w, http.StatusBadRequest, CODE_INVALID, "invalid offset or slice length", nil)
+		return
+	}
+	if s.SliceHook != nil {
+		if err := s.SliceHook(p, offset); err != nil {
+			reply(w, http.StatusBadRequest, CODE_INVALID, err.Error(), nil)
+			return
+		}
+	}
+	sess.slices[offset] = data
+	reply(w, http.StatusOK, CODE_OK, "SUCCESS", map[string]interface{}{"session": sess.id, "offset": offset})
+}
+
+func (s *Server) sliceFinish(w http.ResponseWriter, p string, values map[string]string) {
+	sess := s.findSession(w, p, values["session"])
+	if sess == nil {
+		return
+	}
+	var data bytes.Buffer
+	running := sha1.New()
+	for offset := int64(0); offset < sess.size; offset += sess.sliceSize {
+		slice, ok := sess.slices[offset]
+		if !ok {
+			reply(w, http.StatusBadRequest, CODE_INVALID, "slice at "+strconv.FormatInt(offset, 10)+" missing", nil)
+			return
+		}
+		data.Write(slice)
+		running.Write(slice)
+		sha := runningSha(running)
+		if offset+sess.sliceSize >= sess.size {
+			sha = hex.EncodeToString(running.Sum(nil))
+		}
+		if expected, ok := sess.parts[offset]; ok && !strings.EqualFold(expected, sha) {
+			reply(w, http.StatusBadRequest, CODE_SHA_MISMATCH, "datasha of the slice at "+strconv.FormatInt(offset, 10)+" mismatch", nil)
+			return
+		}
+	}
+	if sess.sha != "" && !strings.EqualFold(sess.sha, shaOf(data.Bytes())) {
+		reply(w, http.StatusBadRequest, CODE_SHA_MISMATCH, "sha mismatch", nil)
+		return
+	}
+	if !s.writable(w, p, sess.cover) {
+		return
+	}
+	delete(s.sessions, sess.id)
+	s.put(p, data.Bytes())
+	reply(w, http.StatusOK, CODE_OK, "SUCCESS", map[string]string{"access_url": s.URL + "/" + s.Bucket + "-" + s.AppID + p})
+}
+
+func (s *Server) sliceList(w http.ResponseWriter, p string) {
+	var sess *session
+	for _, candidate := range s.sessions {
+		if candidate.path == p {
+			sess = candidate
+		}
+	}
+	if sess == nil {
+		reply(w, http.StatusNotFound, CODE_NO_SESSION, "session not exist", nil)
+		return
+	}
+	parts := []map[string]int64{}
+	offsets := make([]int64, 0, len(sess.slices))
+	for offset := range sess.slices {
+		offsets = append(offsets, offset)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	for _, offset := range offsets {
+		parts = append(parts, map[string]int64{"offset": offset, "datalen": int64(len(sess.slices[offset]))})
+	}
+	reply(w, http.StatusOK, CODE_OK, "SUCCESS", map[string]interface{}{
+		"filesize":   sess.size,
+		"session":    sess.id,
+		"slice_size": sess.sliceSize,
+		"listparts":  parts,
+	})
+}
+
+func (s *Server) delete(w http.ResponseWriter, p string) {
+	if strings.HasSuffix(p, "/") {
+		if _, ok := s.dirs[p]; !ok || p == "/" {
+			reply(w, http.StatusNotFound, CODE_NOT_FOUND, "path not exist", nil)
+			return
+		}
+		for child := range s.dirs {
+			if child != p && strings.HasPrefix(child, p) {
+				reply(w, http.StatusBadRequest, CODE_DIR_NOT_EMPTY, "directory not empty", nil)
+				return
+			}
+		}
+		for child := range s.files {
+			if strings.HasPrefix(child, p) {
+				reply(w, http.StatusBadRequest, CODE_DIR_NOT_EMPTY, "directory not empty", nil)
+				return
+			}
+		}
+		delete(s.dirs, p)
+	} else {
+		if _, ok := s.files[p]; !ok {
+			reply(w, http.StatusNotFound, CODE_NOT_FOUND, "path not exist", nil)
+			return
+		}
+		delete(s.files, p)
+	}
+	reply(w, http.StatusOK, CODE_OK, "SUCCESS", nil)
+}
+
+// move renames the file p to dest_fileid, a path of the bucket when it starts with "/"
+// and relative to the directory of p otherwise.
+func (s *Server) move(w http.ResponseWriter, p string, values map[string]string) {
+	f, ok := s.files[p]
+	if !ok {
+		reply(w, http.StatusNotFound, CODE_NOT_FOUND, "path not exist", nil)
+		return
+	}
+	dest := values["dest_fileid"]
+	if !strings.HasPrefix(dest, "/") {
+		dest = parent(p) + dest
+	}
+	if dest == "" || !s.writable(w, dest, values["to_over_write"] == "1") {
+		return
+	}
+	delete(s.files, p)
+	s.mkdirAll(parent(dest))
+	f.mtime = time.Now().Unix()
+	s.files[dest] = f
+	reply(w, http.StatusOK, CODE_OK, "SUCCESS", nil)
+}
+
+func (s *Server) update(w http.ResponseWriter, p string, values map[string]string) {
+	f, ok := s.files[p]
+	if !ok {
+		reply(w, http.StatusNotFound, CODE_NOT_FOUND, "path not exist", nil)
+		return
+	}
+	authority := values["authority"]
+	valid := false
+	for _, a := range AUTHORITIES {
+		valid = valid || a == authority
+	}
+	if !valid {
+		reply(w, http.StatusBadRequest, CODE_INVALID, "invalid authority "+authority, nil)
+		return
+	}
+	f.authority = authority
+	reply(w, http.StatusOK, CODE_OK, "SUCCESS", nil)
+}
+
+// serveDownload serves the file p with Range support, signed by the Authorization header
+// or the sign query parameter.
+func (s *Server) serveDownload(w http.ResponseWriter, r *http.Request, p string) {
+	sign := r.Header.Get("Authorization")
+	if sign == "" {
+		sign = r.URL.Query().Get("sign")
+	}
+	if !s.authorized(sign, p) {
+		http.Error(w, "sign check failed", http.StatusForbidden)
+		return
+	}
+
+	s.mu.Lock()
+	f, ok := s.files[p]
+	var data []byte
+	var mtime int64
+	if ok {
+		data, mtime = f.data, f.mtime
+	}
+	s.mu.Unlock()
+	if !ok || r.Method != "GET" && r.Method != "HEAD" {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeContent(w, r, path.Base(p), time.Unix(mtime, 0), bytes.NewReader(data))
+}
+
+// put stores data at p. The caller must hold mu.
+func (s *Server) put(p string, data []byte) {
+	now := time.Now().Unix()
+	f := &file{data: append([]byte(nil), data...), sha: shaOf(data), ctime: now, mtime: now, authority: "eInvalid"}
+	if old, ok := s.files[p]; ok {
+		f.ctime = old.ctime
+		f.authority = old.authority
+	}
+	s.mkdirAll(parent(p))
+	s.files[p] = f
+}
+
+// mkdirAll creates the directory p and its parents. The caller must hold mu.
+func (s *Server) mkdirAll(p string) {
+	for ; p != ""; p = parent(p) {
+		if _, ok := s.dirs[p]; !ok {
+			s.dirs[p] = time.Now().Unix()
+		}
+	}
+}
+
+// parent returns the directory of p, with a trailing "/", or "" for the root.
+func parent(p string) string {
+	if p == "/" {
+		return ""
+	}
+	i := strings.LastIndex(strings.TrimSuffix(p, "/"), "/")
+	return p[:i+1]
+}
+
+// runningSha returns the datasha of a slice that is not the last: the five state words of
+// the sha1 of the file up to the end of the slice, before padding.
+func runningSha(h hash.Hash) string {
+	state, _ := h.(encoding.BinaryMarshaler).MarshalBinary()
+	return hex.EncodeToString(state[4:24])
+}
+
+func shaOf(data []byte) string {
+	sum := sha1.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,166 @@
+// Package filter selects paths of recursive operations with gitignore-style patterns.
+//
+// Paths are relative to the directory operated on, use "/" as separator and end with "/"
+// for directories. A pattern without "/" matches the base name at any depth, a pattern
+// containing "/" is anchored at the root (a leading "/" is dropped), "**" matches any
+// number of directories and a trailing "/" only matches directories. A pattern matching
+// a directory also matches everything below it.
+package filter
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"strings"
+)
+
+// Filter keeps the paths matching one of its includes (or all when there is none)
+// that are not excluded. The last exclude pattern matching a path decides, an exclude
+// pattern starting with "!" re-includes what earlier patterns excluded.
+type Filter struct {
+	includes []rule
+	excludes []rule
+}
+
+type rule struct {
+	segments []string
+	dirOnly  bool
+	negate   bool
+}
+
+// New returns a Filter of the given include and exclude patterns.
+func New(includes, excludes []string) *Filter {
+	f := &Filter{}
+	for _, pattern := range includes {
+		if r, ok := parseRule(pattern); ok {
+			r.negate = false
+			f.includes = append(f.includes, r)
+		}
+	}
+	for _, pattern := range excludes {
+		f.AddExclude(pattern)
+	}
+	return f
+}
+
+// AddExclude appends an exclude pattern.
+func (f *Filter) AddExclude(pattern string) {
+	if r, ok := parseRule(pattern); ok {
+		f.excludes = append(f.excludes, r)
+	}
+}
+
+// AddExcludeFile appends the exclude patterns of a gitignore-style file, one per line;
+// blank lines and lines starting with "#" are skipped.
+func (f *Filter) AddExcludeFile(name string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		f.AddExclude(line)
+	}
+	return scanner.Err()
+}
+
+// Match reports whether rel is selected. Directories are only checked against the
+// excludes, so an unselected directory can be skipped as a whole.
+func (f *Filter) Match(rel string) bool {
+	if f == nil {
+		return true
+	}
+	rel = strings.TrimPrefix(rel, "/")
+	dir := strings.HasSuffix(rel, "/")
+	segments := strings.Split(strings.TrimSuffix(rel, "/"), "/")
+
+	if excluded(f.excludes, segments, dir) {
+		return false
+	}
+	return dir || len(f.includes) == 0 || included(f.includes, segments)
+}
+
+// excluded applies the excludes to the path and its parent directories.
+func excluded(rules []rule, segments []string, dir bool) bool {
+	for i := 1; i <= len(segments); i++ {
+		isDir := dir || i < len(segments)
+		result := false
+		for _, r := range rules {
+			if r.match(segments[:i], isDir) {
+				result = !r.negate
+			}
+		}
+		if result {
+			return true
+		}
+	}
+	return false
+}
+
+// included reports whether an include matches the file or one of its parent directories.
+func included(rules []rule, segments []string) bool {
+	for i := 1; i <= len(segments); i++ {
+		for _, r := range rules {
+			if r.match(segments[:i], i < len(segments)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func parseRule(pattern string) (rule, bool) {
+	r := rule{}
+	if strings.HasPrefix(pattern, "!") {
+		r.negate = true
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		r.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if pattern == "" {
+		return r, false
+	}
+	if !strings.Contains(pattern, "/") {
+		pattern = "**/" + pattern
+	}
+	r.segments = strings.Split(strings.TrimPrefix(pattern, "/"), "/")
+	return r, true
+}
+
+func (r rule) match(segments []string, dir bool) bool {
+	if r.dirOnly && !dir {
+		return false
+	}
+	return matchSegments(r.segments, segments)
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,84 @@
+package filter
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	for _, c := range []struct {
+		includes, excludes []string
+		rel                string
+		expected           bool
+	}{
+		{nil, nil, "a.txt", true},
+		{nil, []string{"*.log"}, "a.log", false},
+		{nil, []string{"*.log"}, "d/e/a.log", false},
+		{nil, []string{"*.log"}, "a.txt", true},
+
+		// anchoring
+		{nil, []string{"/build"}, "build/x", false},
+		{nil, []string{"/build"}, "src/build/x", true},
+		{nil, []string{"src/*.go"}, "src/a.go", false},
+		{nil, []string{"src/*.go"}, "src/sub/a.go", true},
+		{nil, []string{"src/*.go"}, "other/src/a.go", true},
+
+		// **
+		{nil, []string{"a/**/b"}, "a/b", false},
+		{nil, []string{"a/**/b"}, "a/x/y/b", false},
+		{nil, []string{"a/**/b"}, "a/x", true},
+		{nil, []string{"**/node_modules/"}, "web/node_modules/x/index.js", false},
+
+		// directories only
+		{nil, []string{"build/"}, "build/", false},
+		{nil, []string{"build/"}, "build/a.o", false},
+		{nil, []string{"build/"}, "build", true},
+
+		// negation
+		{nil, []string{"*.log", "!keep.log"}, "keep.log", true},
+		{nil, []string{"*.log", "!keep.log"}, "x.log", false},
+		{nil, []string{"!keep.log", "*.log"}, "keep.log", false},
+		// a file below an excluded directory cannot be re-included
+		{nil, []string{"logs/", "!logs/keep.log"}, "logs/keep.log", false},
+
+		// includes
+		{[]string{"*.go"}, nil, "a.go", true},
+		{[]string{"*.go"}, nil, "sub/a.go", true},
+		{[]string{"*.go"}, nil, "a.txt", false},
+		{[]string{"*.go"}, nil, "sub/", true},
+		{[]string{"docs"}, nil, "docs/a.txt", true},
+		{[]string{"docs"}, nil, "a.txt", false},
+		{[]string{"*.go"}, []string{"vendor/"}, "vendor/a.go", false},
+	} {
+		if matched := New(c.includes, c.excludes).Match(c.rel); matched != c.expected {
+			t.Errorf("include %q exclude %q: Match(%q) = %v, expected %v", c.includes, c.excludes, c.rel, matched, c.expected)
+		}
+	}
+
+	var f *Filter
+	if !f.Match("a.txt") {
+		t.Error("nil Filter does not match")
+	}
+}
+
+func TestAddExcludeFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), ".cosignore")
+	if err := ioutil.WriteFile(name, []byte("# comment\n\n*.tmp\n  cache/  \n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f := New(nil, nil)
+	if err := f.AddExcludeFile(name); err != nil {
+		t.Fatal(err)
+	}
+	for rel, expected := range map[string]bool{
+		"a.tmp":     false,
+		"cache/a":   false,
+		"# comment": true,
+		"a.txt":     true,
+	} {
+		if matched := f.Match(rel); matched != expected {
+			t.Errorf("Match(%q) = %v, expected %v", rel, matched, expected)
+		}
+	}
+}
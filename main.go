@@ -1,13 +1,21 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"gocos/config"
 	"gocos/cosclient"
-	"io/ioutil"
+	"log"
 	"os"
+	"os/signal"
 	"os/user"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
 
 	"gopkg.in/alecthomas/kingpin.v2"
 	"gocos/cmd"
@@ -15,40 +23,168 @@ import (
 
 var (
 	app = kingpin.New("gocos", "A command-line tool for qcloud cos.")
-	configFile = app.Flag("config", "config file path").String()
+	configFile = app.Flag("config", "config file path").Envar("GOCOS_CONFIG").String()
+	profile = app.Flag("profile", "config profile to use instead of the current one").Envar("GOCOS_PROFILE").String()
+	appID = app.Flag("app-id", "AppID, overrides the config").String()
+	secretID = app.Flag("secret-id", "SecretID, overrides the config and GOCOS_SECRET_ID").String()
+	secretKey = app.Flag("secret-key", "SecretKey, overrides the config and GOCOS_SECRET_KEY").String()
+	sessionToken = app.Flag("session-token", "session token of temporary --secret-id/--secret-key").String()
+	bucket = app.Flag("bucket", "Bucket, overrides the config").String()
+	region = app.Flag("region", "region (Local), overrides the config").String()
+	fileConcurrency = app.Flag("file-concurrency", "files transferred concurrently (FileConcurrency), overrides the config").String()
+	uploadPartSize = app.Flag("upload-part-size", "slice size of large uploads, e.g. 2M (UploadPartSize), overrides the config").String()
+	uploadConcurrency = app.Flag("upload-concurrency", "slices uploaded concurrently per file (UploadConcurrency), overrides the config").String()
+	limitRate = app.Flag("limit-rate", "bytes per second of all transfers, e.g. 5M (LimitRate), overrides the config and its RateSchedule").String()
+	output = app.Flag("output", "output format: text, json or ndjson").Short('o').Default("text").Enum("text", "json", "ndjson")
+	debug = app.Flag("debug", "log every http request to stderr").Bool()
+	progress = app.Flag("progress", "show the progress of transfers on stderr, --no-progress hides it").Default("true").Bool()
 
-	env = app.Command("env", "show current config")
-	config = ""
-	Failure = false
+	env = app.Command("env", "show current config and where each value came from")
 )
 
-func loadConfig(configFile *string) []byte {
+// configPath returns the config file to use, which may not exist yet.
+func configPath(configFile string) string {
+	if len(configFile) > 0 {
+		return configFile
+	}
+	if _, err := os.Stat("cos.config.json"); err == nil {
+		return "cos.config.json"
+	}
+	return getUserHome() + string(os.PathSeparator) + ".cos.config.json"
+}
 
-	var file *os.File
-	var err error
-	if len(*configFile) > 0 {
-		_, err = os.Stat(*configFile)
-		exitIfErr(err)
-	} else {
-		*configFile = "cos.config.json"
-		_, err = os.Stat(*configFile)
-		if err != nil && os.IsNotExist(err) {
-			*configFile = getUserHome() + string(os.PathSeparator) + ".cos.config.json"
+func loadConfig(configFile string, create bool) *config.File {
+	if len(configFile) > 0 && !create {
+		_, err := os.Stat(configFile)
+		if err != nil {
+			exitIfErr(usageError{err})
+		}
+	}
+	path, err := filepath.Abs(configPath(configFile))
+	exitIfErr(err)
+	file, err := config.Load(path)
+	exitIfErr(err)
+	return file
+}
+
+// resolveConfig configures client with, from the highest precedence, the flags, the GOCOS_*
+// environment variables and the profile. The credentials come from the first of the flags,
+// the environment, the profile and the credential_process command that has both keys, and
+// are retrieved again from there when they are temporary and about to expire.
+func resolveConfig(ctx context.Context, file *config.File, profile string, client *cosclient.CosClient, sources map[string]string) error {
+	if err := file.Apply(profile, client, sources); err != nil {
+		return err
+	}
+	if err := config.ApplyEnv(client, sources); err != nil {
+		return err
+	}
+	for _, flag := range []struct {
+		key, name, value string
+		size             bool
+	}{
+		{"AppID", "--app-id", *appID, false},
+		{"Bucket", "--bucket", *bucket, false},
+		{"Local", "--region", *region, false},
+		{"FileConcurrency", "--file-concurrency", *fileConcurrency, false},
+		{"UploadPartSize", "--upload-part-size", *uploadPartSize, true},
+		{"UploadConcurrency", "--upload-concurrency", *uploadConcurrency, false},
+		{"LimitRate", "--limit-rate", *limitRate, true},
+	} {
+		if flag.value == "" {
+			continue
+		}
+		if flag.size {
+			size, err := cmd.ParseSize(flag.value)
+			if err != nil {
+				return usageError{fmt.Errorf("flag %s: %w", flag.name, err)}
+			}
+			flag.value = strconv.FormatInt(size, 10)
+		}
+		if err := config.Override(client, flag.key, flag.value, "flag "+flag.name, sources); err != nil {
+			return usageError{err}
 		}
 	}
-	//fmt.Printf("load config from  : %s\n", *configFile)
-	file, _ = os.Open(*configFile)
-	defer file.Close()
-	text, e := ioutil.ReadAll(file)
-	exitIfErr(e)
-	config, _ = filepath.Abs(*configFile)
-	return text
+
+	if *limitRate != "" {
+		client.RateSchedule = nil
+	}
+
+	client.Credentials = cosclient.ChainProvider{
+		&cosclient.StaticProvider{Credentials: cosclient.Credentials{SecretID: *secretID, SecretKey: *secretKey, SessionToken: *sessionToken, Source: "flag --secret-id/--secret-key"}},
+		cosclient.EnvProvider{},
+		&cosclient.StaticProvider{Credentials: cosclient.Credentials{SecretID: client.SecretID, SecretKey: client.SecretKey, SessionToken: client.SessionToken, Source: sources["SecretKey"]}},
+		&cosclient.ProcessProvider{Command: client.CredentialProcess},
+	}
+	creds, err := client.CurrentCredentials(ctx)
+	if errors.Is(err, cosclient.ErrNoCredentials) {
+		// let the service reject the requests
+		client.Credentials = nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	client.SecretID, client.SecretKey, client.SessionToken = creds.SecretID, creds.SecretKey, creds.SessionToken
+	for _, key := range []string{"SecretID", "SecretKey", "SessionToken"} {
+		sources[key] = creds.Source
+	}
+	return nil
 }
 
+// mask hides a secret but for its last 4 characters.
+func mask(secret string) string {
+	if len(secret) <= 8 {
+		return strings.Repeat("*", len(secret))
+	}
+	return "****************" + secret[len(secret)-4:]
+}
+
+// printEnv prints the config of client with the source of each value.
+func printEnv(file *config.File, profile string, client *cosclient.CosClient, sources map[string]string) {
+	fmt.Println("config:  " + file.Path)
+	fmt.Println("profile: " + profile)
+
+	data, _ := json.Marshal(client)
+	values := map[string]json.RawMessage{}
+	json.Unmarshal(data, &values)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, key := range config.Keys() {
+		value, source := string(values[key]), sources[key]
+		if (key == "SecretKey" || key == "SessionToken") && value != "" {
+			var secret string
+			json.Unmarshal(values[key], &secret)
+			masked, _ := json.Marshal(mask(secret))
+			value = string(masked)
+		}
+		if value == "" {
+			value = "-"
+		}
+		if source == "" {
+			source = "default"
+		}
+		fmt.Fprintf(w, "%s\t%s\t(%s)\n", key, value, source)
+	}
+	w.Flush()
+}
+
+// usageError is an invalid argument of gocos.
+type usageError struct {
+	error
+}
+
+func (e usageError) Unwrap() error {
+	return e.error
+}
+
+// exitIfErr ends gocos on e, with cmd.EXIT_USAGE when the arguments are to blame.
 func exitIfErr(e error) {
 	if e != nil {
 		fmt.Fprintf(os.Stderr, "%s\n", e)
-		os.Exit(1)
+		var usage usageError
+		if errors.As(e, &usage) || errors.Is(e, config.ErrProfileNotFound) {
+			os.Exit(cmd.EXIT_USAGE)
+		}
+		os.Exit(cmd.EXIT_FAILURE)
 	}
 }
 
@@ -81,25 +217,54 @@ func main() {
 		cmd.CreateMvCommand(app),
 		cmd.CreateCatCommand(app),
 		cmd.CreateUpdateCommand(app),
+		cmd.CreateSyncCommand(app),
+		cmd.CreateSignCommand(app),
+	}
+	configCommand := cmd.CreateConfigCommand(app)
+
+	command, err := app.Parse(os.Args[1:])
+	if err != nil {
+		app.Errorf("%s, try --help", err)
+		os.Exit(cmd.EXIT_USAGE)
+	}
+
+	file := loadConfig(*configFile, configCommand.Handles(command))
+	if configCommand.Handles(command) {
+		configCommand.Run(file, *profile, command)
+		return
 	}
 
-	var command = kingpin.MustParse(app.Parse(os.Args[1:]))
+	// cancel transfers on Ctrl-C so partial downloads get cleaned up
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	client := &cosclient.CosClient{}
-	json.Unmarshal(loadConfig(configFile), client)
+	sources := map[string]string{}
+	profileName := file.ProfileName(*profile)
+	exitIfErr(resolveConfig(ctx, file, profileName, client, sources))
+	client.OnRetry = cmd.ReportRetry
+	if *debug {
+		client.Middleware = append(client.Middleware, cosclient.LogRequests(log.New(os.Stderr, "[http] ", 0).Printf))
+	}
 
 	if env.FullCommand() == command {
-		fmt.Println("config: " + config)
-
-		encoder := json.NewEncoder(os.Stdout)
-		encoder.SetIndent("", "  ")
-		encoder.Encode(client)
+		printEnv(file, profileName, client, sources)
 	} else {
+		cmd.SetOutput(*output)
+		if *progress {
+			cmd.ShowProgress(client)
+		}
 		for _, comm := range commands {
 			if comm.Name() == command {
-				comm.Execute(client)
+				comm.Execute(ctx, client)
 			}
 		}
+		cmd.CloseOutput()
+		if ctx.Err() != nil {
+			fmt.Fprintln(os.Stderr, "interrupted")
+			os.Exit(cmd.EXIT_INTERRUPTED)
+		}
+		os.Exit(cmd.ExitCode())
 	}
 
 }
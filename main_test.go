@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"gocos/config"
+	"gocos/cosclient"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestResolveCredentials(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("credential_process commands are sh scripts")
+	}
+	for _, c := range []struct {
+		name             string
+		env, profile     bool
+		expected, source string
+	}{
+		{"env", true, true, "env-id", "env GOCOS_SECRET_ID/GOCOS_SECRET_KEY"},
+		{"profile", false, true, "profile-id", "profile default"},
+		{"credential_process", false, false, "process-id", "credential_process"},
+	} {
+		t.Setenv(cosclient.ENV_SECRET_ID, "")
+		t.Setenv(cosclient.ENV_SECRET_KEY, "")
+		if c.env {
+			t.Setenv(cosclient.ENV_SECRET_ID, "env-id")
+			t.Setenv(cosclient.ENV_SECRET_KEY, "env-key")
+		}
+		file, _ := config.Load(filepath.Join(t.TempDir(), "cos.config.json"))
+		file.Set(config.DEFAULT_PROFILE, "CredentialProcess", `echo '{"SecretID": "process-id", "SecretKey": "process-key"}'`)
+		if c.profile {
+			file.Set(config.DEFAULT_PROFILE, "SecretID", "profile-id")
+			file.Set(config.DEFAULT_PROFILE, "SecretKey", "profile-key")
+		}
+
+		client, sources := &cosclient.CosClient{}, map[string]string{}
+		if err := resolveConfig(context.Background(), file, config.DEFAULT_PROFILE, client, sources); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if client.SecretID != c.expected || sources["SecretKey"] != c.source {
+			t.Errorf("%s: SecretID %s from %s, expected %s from %s", c.name, client.SecretID, sources["SecretKey"], c.expected, c.source)
+		}
+	}
+}
+
+func TestMask(t *testing.T) {
+	for secret, expected := range map[string]string{
+		"":                     "",
+		"short":                "*****",
+		"12345678":             "********",
+		"a-much-longer-secret": "****************cret",
+	} {
+		if masked := mask(secret); masked != expected {
+			t.Errorf("mask(%q) = %q, expected %q", secret, masked, expected)
+		}
+	}
+}
+
+func TestPrintEnvMasksSecrets(t *testing.T) {
+	file, _ := config.Load(filepath.Join(t.TempDir(), "cos.config.json"))
+	client := &cosclient.CosClient{SecretID: "AKIDexample", SecretKey: "secret-key-1234", SessionToken: "session-token-5678"}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	printEnv(file, config.DEFAULT_PROFILE, client, map[string]string{})
+	os.Stdout = stdout
+	w.Close()
+	out, _ := ioutil.ReadAll(r)
+
+	for _, secret := range []string{client.SecretKey, client.SessionToken} {
+		if strings.Contains(string(out), secret) {
+			t.Errorf("env prints the secret %s:\n%s", secret, out)
+		}
+	}
+	for _, expected := range []string{"AKIDexample", `"****************1234"`, `"****************5678"`} {
+		if !strings.Contains(string(out), expected) {
+			t.Errorf("env lacks %s:\n%s", expected, out)
+		}
+	}
+}